@@ -0,0 +1,41 @@
+package bloat
+
+import (
+	"archive/zip"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// inspectArchive adds an entry to the DirMap for the file at path, if it's a zip
+// archive, as if it were a directory containing the archive's contents, with
+// their uncompressed sizes. The entry isn't rolled up into the archive's parent
+// directories, whose totals only include the size of the archive itself. real is
+// the resolved path of the file.
+func (b *Bloat) inspectArchive(path string, real string) {
+	if b.ByExtension || !strings.EqualFold(filepath.Ext(real), ".zip") {
+		return
+	}
+	r, err := zip.OpenReader(real)
+	if err != nil {
+		b.Errors = append(b.Errors, fmt.Errorf("can't inspect %s: %w", path, err))
+		return
+	}
+	defer r.Close()
+	contents := &DirInfo{}
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		bytes := int64(f.UncompressedSize64)
+		contents.Bytes += bytes
+		contents.Files++
+		contents.largest(filepath.Join(path, filepath.FromSlash(f.Name)), bytes)
+		contents.touch(f.Modified)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.pruned(path) {
+		b.dirInfo(path).merge(contents)
+	}
+}
@@ -0,0 +1,806 @@
+// Package bloat totals up the disk space used under directory trees, and
+// reports which directories are the most bloated.
+package bloat
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// DirInfo stores the amount of file bloat under a single directory, the
+// number of files it's spread across, the largest of those files, and the
+// modification time of the newest of them. SelfFiles counts only the files
+// immediately inside the directory, and SelfBytes their total; Reclaimable the
+// bytes in files which look like they could be cleaned up.
+type DirInfo struct {
+	Path         string    `json:"path"`
+	Bytes        int64     `json:"bytes"`
+	Files        int64     `json:"files"`
+	SelfFiles    int64     `json:"self_files,omitempty"`
+	SelfBytes    int64     `json:"self_bytes,omitempty"`
+	MaxFile      string    `json:"max_file,omitempty"`
+	MaxFileBytes int64     `json:"max_file_bytes,omitempty"`
+	Newest       time.Time `json:"-"`
+	Reclaimable  int64     `json:"reclaimable,omitempty"`
+}
+
+// merge adds the totals for some files to the totals for the directory, and
+// records the largest and newest of them if they're bigger or newer than any
+// seen before
+func (info *DirInfo) merge(totals *DirInfo) {
+	info.Bytes += totals.Bytes
+	info.Files += totals.Files
+	info.Reclaimable += totals.Reclaimable
+	if totals.MaxFile != "" {
+		info.largest(totals.MaxFile, totals.MaxFileBytes)
+	}
+	info.touch(totals.Newest)
+}
+
+// largest records the file at path as the largest file under the directory if
+// it's bigger than any seen before
+func (info *DirInfo) largest(path string, bytes int64) {
+	if info.MaxFile == "" || bytes > info.MaxFileBytes {
+		info.MaxFile = path
+		info.MaxFileBytes = bytes
+	}
+}
+
+// touch records modified as the modification time of the newest file under the
+// directory if it's later than any seen before
+func (info *DirInfo) touch(modified time.Time) {
+	if modified.After(info.Newest) {
+		info.Newest = modified
+	}
+}
+
+// Output formats for the report
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	// FormatJSONLines outputs each directory as a JSON object on a line of its
+	// own, so the report can be processed as it's read
+	FormatJSONLines = "jsonl"
+	FormatCSV       = "csv"
+	FormatTree      = "tree"
+	// FormatPrint0 outputs just the paths, each terminated by a NUL byte
+	FormatPrint0 = "print0"
+	// FormatDU outputs the size in bytes and path of each directory separated
+	// by a tab, like du -b
+	FormatDU = "du"
+	// FormatPrometheus outputs the sizes as metrics in the Prometheus text
+	// exposition format
+	FormatPrometheus = "prometheus"
+	// FormatHTML outputs a self-contained HTML page with a sortable table of the
+	// directories
+	FormatHTML = "html"
+	// FormatTemplate executes Template for each directory
+	FormatTemplate = "template"
+)
+
+// Bloat stores the amount of bloat found.
+//
+// AddBloat and AddFile may be called from multiple goroutines at once, including
+// while a scan is running, and so may Sort and Report. The other methods, and
+// changes to the fields, mustn't be made concurrently with anything else.
+type Bloat struct {
+	DirMap map[string]*DirInfo
+	Dirs   []*DirInfo
+	Roots  []string
+	// TotalBytes and TotalFiles are the totals of everything counted
+	TotalBytes int64
+	TotalFiles int64
+	Abs        bool
+	// RelativeTo, if set, is the absolute path of a directory which the paths in
+	// the report are made relative to, whatever the scan roots are; paths which
+	// can't be made relative to it are reported as absolute paths
+	RelativeTo string
+	// PrefixRoots reports paths as they were found, starting with the scan
+	// roots as they were given to Scan, so that the directories under different
+	// roots are kept apart without making the paths absolute
+	PrefixRoots bool
+	// NormalizeUnicode converts the paths used as DirMap keys to Unicode
+	// normalization form C, so that a directory whose name is found in more
+	// than one form, as can happen with files created on macOS, is only
+	// reported once
+	NormalizeUnicode bool
+	// RootLabel, if set, replaces the scan root at the start of the paths in the
+	// report, so that a deep root doesn't clutter every line. Only the report is
+	// changed; the keys in the DirMap stay the same.
+	RootLabel string
+	Top       int
+	// CumulativePercent, if greater than zero, stops the report at the directory
+	// which brings the running total of the directories reported to that
+	// percentage of the total, so that the report shows where most of the space
+	// has gone
+	CumulativePercent float64
+	Depth             int
+	// LowMemory, if Depth is zero or more, only keeps totals for directories up
+	// to Depth levels below their scan roots, which saves memory and time when
+	// scanning huge trees. The totals kept are the same.
+	LowMemory bool
+	// MaxEntries, if greater than zero, limits the number of entries in the
+	// DirMap, to bound the memory used; once there are that many, the totals
+	// for any other directories go under OtherDirs
+	MaxEntries int
+	// MinDepth hides directories fewer than MinDepth levels below their scan root
+	MinDepth int
+	MinSize  int64
+	// MaxSize, if greater than zero, hides directories bigger than MaxSize
+	MaxSize int64
+	// ReportMatch, if not empty, hides directories whose paths in the report
+	// don't match any of the glob patterns, which are matched against the whole
+	// path and against every trailing part of it, so that "*/cache" matches any
+	// directory named cache with a parent. Everything is still scanned and
+	// counted.
+	ReportMatch []string
+	// Summary reports only the totals for the scan roots, in the order they were
+	// scanned. As with Compare, the roots are kept apart even without Abs.
+	Summary bool
+	// GrandTotal adds a line with the grand total of everything scanned to the
+	// end of the text and du format reports
+	GrandTotal bool
+	// Empty adds every directory scanned to the DirMap, and reports only those
+	// with no files under them
+	Empty bool
+	// Compare reports only the scan roots, in the order they're sorted in. The
+	// roots are kept apart even without Abs, and shown as they were given to Scan.
+	Compare bool
+	// NoRoot leaves the scan roots, and the directories above them, out of the report
+	NoRoot bool
+	Format string
+	// Template is the template executed for each directory in FormatTemplate.
+	// It's passed a TemplateEntry.
+	Template *template.Template
+	// Meta, if set, is included in the JSON report, which is then an object with
+	// the metadata under "meta" and the directories under "entries". The times
+	// and totals are filled in when the report is written.
+	Meta *ReportMeta
+	// Base selects SI (10) or IEC (2) units for sizes in the text report, or
+	// raw byte counts if it's 0; Precision is the number of decimal places
+	Base      int
+	Precision int
+	// Human formats sizes the same way as du -h instead, overriding Base and
+	// Precision, and GroupDigits formats them as numbers of bytes with commas
+	// between groups of three digits, overriding Human too
+	Human       bool
+	GroupDigits bool
+	Verbose     bool
+	// Log receives the paths scanned if Verbose is set
+	Log io.Writer
+	// SampleLimit, if greater than zero, stops scanning after that many files,
+	// to give a quick estimate; Sampled is set if the limit was reached
+	SampleLimit int64
+	Sampled     bool
+	// Progress, if set, receives a line showing the number of files scanned so
+	// far and their total size, which is updated in place a few times a second
+	// and cleared when scanning finishes
+	Progress io.Writer
+	// Errors collects the errors for files and directories which couldn't be
+	// read, and were skipped
+	Errors []error
+	// RecordSkipped records every file and directory skipped, and the reason,
+	// for Skipped to return
+	RecordSkipped bool
+	skipped       []SkippedPath
+	Exclude       []string
+	// IgnoreCase matches the Exclude, Include, Disposable and ReportMatch
+	// patterns without regard to case. Patterns in .gitignore files are still
+	// case sensitive, as they are for git by default.
+	IgnoreCase bool
+	// ExcludePaths skips files and directories whose absolute paths are, or are
+	// under, any of the paths listed, which can be relative to the current
+	// directory
+	ExcludePaths []string
+	// Include, if not empty, restricts the files counted to those matching at
+	// least one of the patterns. All directories are still scanned.
+	Include []string
+	// NoHidden skips files and directories whose names begin with a dot, other
+	// than the scan roots themselves
+	NoHidden bool
+	// GitIgnore skips files and directories which are ignored by .gitignore
+	// files, and OnlyIgnored counts only those files
+	GitIgnore   bool
+	OnlyIgnored bool
+	// Color colors the sizes in the text report red if they're at least RedSize,
+	// yellow if they're at least YellowSize, and green otherwise
+	Color      bool
+	RedSize    int64
+	YellowSize int64
+	// QuoteNames escapes non-printable characters in the paths in the text report
+	QuoteNames bool
+	// ShowCount adds the number of files to the text and CSV reports
+	ShowCount bool
+	// Self reports the total size and number of the files immediately in each
+	// directory, rather than everything under it
+	Self bool
+	// ShowAverage adds the average size of the files under each directory to the
+	// text and CSV reports
+	ShowAverage bool
+	// ShowMax adds the largest file under each directory to the text and CSV reports
+	ShowMax bool
+	// ShowPercent adds each directory's percentage of TotalBytes to the text report
+	ShowPercent bool
+	// Fields, if set, selects the columns of the text and tree reports, in the
+	// order they're shown, from AllFields, in place of ShowCount, ShowAverage,
+	// ShowMax and ShowPercent
+	Fields []string
+	// CountLinks counts a file with multiple hard links once for every link,
+	// rather than only the first time it's seen. Files whose device and inode
+	// numbers aren't available are told apart by path instead, so each of their
+	// links is counted anyway. Directories are told apart the same way, so
+	// without CountLinks a directory bind mounted at several paths is only
+	// scanned at the first of them.
+	CountLinks bool
+	// CountDirs adds the size of each directory itself, as reported by stat, to
+	// the totals for the directories containing it. Otherwise, as with du,
+	// directories contribute no bytes, and only the files in them count. The
+	// numbers of files aren't changed either way.
+	CountDirs bool
+	// OneFileSystem skips directories on a different device to their scan root.
+	// Directories are never skipped if either device number isn't available.
+	OneFileSystem bool
+	// FollowSymlinks scans the directories which symbolic links point to
+	FollowSymlinks bool
+	// FollowTopLevel scans the directories which symbolic links directly in the
+	// scan roots point to, but not those deeper down
+	FollowTopLevel bool
+	// FollowRoot scans the directories which scan roots point to if they're
+	// symbolic links, whether or not FollowSymlinks is set, and shows the
+	// targets alongside the roots in the text and tree reports
+	FollowRoot bool
+	// InspectArchives reports zip archives as if they were directories holding
+	// their contents, with those contents' uncompressed sizes
+	InspectArchives bool
+	// DiskUsage counts the space allocated on disk for each file rather than
+	// its apparent size, where the platform provides it
+	DiskUsage bool
+	// Compressed counts the total length of each file's extents on disk, as the
+	// filesystem reports them, which leaves out holes. It's only supported on
+	// Linux; elsewhere, and on filesystems which can't report extents, it's the
+	// same as DiskUsage. Compressed extents, as on btrfs, are only reported at
+	// their uncompressed length, so files with any are counted as with
+	// DiskUsage, which doesn't reflect btrfs compression either; compression is
+	// only reflected where the allocated blocks reflect it, as on ZFS.
+	Compressed bool
+	// Fast makes Scan use a quicker way of reading the sizes of the files in
+	// each directory, where the platform has one, currently only Linux, and add
+	// them to the totals a directory at a time. The totals are the same; on a
+	// tree of around 400,000 files already in the page cache it takes about
+	// half as long, and BenchmarkScan shows a similar difference on a smaller
+	// tree. It's only used when no options which need each file to be looked
+	// at more closely are set: Exclude, ExcludePaths, Include,
+	// NoHidden, GitIgnore, OnlyIgnored, ModifiedBefore, ModifiedAfter,
+	// FileSizeCap, SizeFunc, Compressed, OneFileSystem, FollowSymlinks,
+	// FollowTopLevel, FollowRoot, InspectArchives, Duplicates, Verbose and
+	// SampleLimit; otherwise the usual scan is done.
+	Fast bool
+	// SizeFunc, if set, is called by the scans to find the size to count for
+	// each file and directory found, which can be any measure of its cost, in
+	// place of its size in bytes. It's passed the path the file was found at.
+	SizeFunc func(path string, info os.FileInfo) int64
+	// BlockSize, if greater than zero, rounds the size of each file added up to
+	// a multiple of BlockSize, to account for the space allocated on disk
+	BlockSize int64
+	// ByExtension totals files by their extension rather than directory, so
+	// the report lists extensions instead of directories
+	ByExtension bool
+	// ModifiedBefore and ModifiedAfter, if not zero, restrict the files counted
+	// to those last modified before or after the specified times
+	ModifiedBefore time.Time
+	ModifiedAfter  time.Time
+	// FileSizeCap, if greater than zero, leaves files bigger than it out of the
+	// totals, so that a few huge files don't hide lots of smaller ones
+	FileSizeCap int64
+	// Breakdown, if set, is the path of a directory, as it appears in the report,
+	// whose files are also totalled by extension for ReportBreakdown. Only the
+	// files directly in the directory are included, unless BreakdownRecursive is
+	// set.
+	Breakdown          string
+	BreakdownRecursive bool
+	breakdown          map[string]*DirInfo
+	// Disposable and StaleBefore, if set, pick out the files counted as
+	// Reclaimable for ReportCleanup: those with a name, or in a directory with
+	// a name, matching one of the Disposable glob patterns, and those last
+	// modified before StaleBefore
+	Disposable  []string
+	StaleBefore time.Time
+	// labels holds the names to display for scan roots whose keys are relative
+	// to themselves
+	labels map[string]string
+	// base is the key of the root currently being scanned, which totals aren't
+	// rolled up beyond
+	base string
+	// Largest, if set, keeps track of the largest individual files, and Sort
+	// and Report list them instead of directories
+	Largest *LargestFiles
+	// Duplicates, if set, keeps track of the files scanned, for
+	// ReportDuplicates to find the ones with identical contents
+	Duplicates *Duplicates
+	// mu guards DirMap, Dirs, the totals and the other state updated by AddBloat
+	// and AddFile
+	mu     sync.Mutex
+	inodes map[inode]bool
+	// scanned counts the files scanned, for the progress line
+	scanned int64
+	// started and finished are when the first scan started and the last one
+	// finished
+	started       time.Time
+	finished      time.Time
+	lastProgress  time.Time
+	progressWidth int
+	paths         map[string]bool
+	visited       map[string]bool
+}
+
+// inode identifies a file by its device and inode numbers
+type inode struct {
+	dev uint64
+	ino uint64
+}
+
+// NewBloat returns a new empty Bloat, with paths made absolute if absmode is set
+func NewBloat(absmode bool) *Bloat {
+	return &Bloat{
+		DirMap:  make(map[string]*DirInfo),
+		Abs:     absmode,
+		Depth:   -1,
+		Format:  FormatText,
+		Base:    10,
+		Log:     os.Stderr,
+		inodes:  make(map[inode]bool),
+		paths:   make(map[string]bool),
+		visited: make(map[string]bool),
+	}
+}
+
+// Sort orders for Sort
+const (
+	SortSize = "size"
+	SortPath = "path"
+	// SortMTime sorts by the modification time of the newest file under each
+	// directory
+	SortMTime = "mtime"
+)
+
+// Sort sorts the data in the DirMap map, or the files recorded by Largest if it's
+// set, and places it in the Dirs slice. If Self is set, the Dirs have just the
+// totals for the files immediately in each directory.
+// SortSize puts the biggest bloatiest directories at the top, with directories
+// of the same size sorted by path so the order is the same from one run to the
+// next. SortPath sorts alphabetically by path, and SortMTime puts the directories
+// with the most recently modified files at the top. If reverse is set, the order is
+// reversed.
+func (b *Bloat) Sort(by string, reverse bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.Largest != nil {
+		b.Dirs = b.Largest.Files()
+	} else if b.Self {
+		b.Dirs = make([]*DirInfo, 0, len(b.DirMap))
+		for _, info := range b.DirMap {
+			b.Dirs = append(b.Dirs, &DirInfo{Path: info.Path, Bytes: info.SelfBytes, Files: info.SelfFiles,
+				SelfFiles: info.SelfFiles, SelfBytes: info.SelfBytes, Newest: info.Newest})
+		}
+	} else {
+		b.Dirs = make([]*DirInfo, 0, len(b.DirMap))
+		for _, info := range b.DirMap {
+			b.Dirs = append(b.Dirs, info)
+		}
+	}
+	var less func(dx, dy *DirInfo) bool
+	switch by {
+	case SortPath:
+		less = func(dx, dy *DirInfo) bool { return dx.Path < dy.Path }
+	case SortMTime:
+		less = func(dx, dy *DirInfo) bool {
+			if !dx.Newest.Equal(dy.Newest) {
+				return dx.Newest.After(dy.Newest)
+			}
+			return dx.Path < dy.Path
+		}
+	default:
+		less = func(dx, dy *DirInfo) bool {
+			if dx.Bytes != dy.Bytes {
+				return dx.Bytes > dy.Bytes
+			}
+			return dx.Path < dy.Path
+		}
+	}
+	sort.SliceStable(b.Dirs, func(x, y int) bool {
+		if reverse {
+			return less(b.Dirs[y], b.Dirs[x])
+		}
+		return less(b.Dirs[x], b.Dirs[y])
+	})
+}
+
+// Crowded returns the directories which immediately contain more than max
+// files, however small they are, with the most crowded first
+func (b *Bloat) Crowded(max int64) []*DirInfo {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var dirs []*DirInfo
+	for _, info := range b.DirMap {
+		if info.SelfFiles > max {
+			dirs = append(dirs, info)
+		}
+	}
+	sort.Slice(dirs, func(x, y int) bool {
+		if dirs[x].SelfFiles != dirs[y].SelfFiles {
+			return dirs[x].SelfFiles > dirs[y].SelfFiles
+		}
+		return dirs[x].Path < dirs[y].Path
+	})
+	return dirs
+}
+
+// dirInfo returns the DirInfo for the specified directory, adding a new map
+// entry to the DirMap if necessary. If the DirMap already has MaxEntries
+// entries, the entry for OtherDirs is returned instead, unless dir is a scan root.
+func (b *Bloat) dirInfo(dir string) *DirInfo {
+	info, ok := b.DirMap[dir]
+	if !ok {
+		if b.MaxEntries > 0 && len(b.DirMap) >= b.MaxEntries && !b.isRoot(dir) {
+			dir = OtherDirs
+			if info, ok = b.DirMap[dir]; ok {
+				return info
+			}
+		}
+		info = &DirInfo{Path: dir}
+		b.DirMap[dir] = info
+	}
+	return info
+}
+
+// OtherDirs is the key which directories are totalled under once the DirMap has
+// MaxEntries entries
+const OtherDirs = "(other)"
+
+// Truncated reports whether the DirMap reached MaxEntries entries, so that some
+// directories were totalled under OtherDirs
+func (b *Bloat) Truncated() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.DirMap[OtherDirs]
+	return ok
+}
+
+// AddBloat adds the specified number of bytes of bloat to the total for the specified
+// directory, adding new map entries to the DirMap as necessary.
+func (b *Bloat) AddBloat(dir string, bytes int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dirInfo(dir).Bytes += bytes
+}
+
+// AddFile adds the bloat from a single file to the total for the file's directory
+// and all parent directores of that directory, and counts the file in each of them.
+// If ByExtension is set, the file is instead added to the total for its extension.
+// If BlockSize is set, the size is first rounded up to a multiple of it.
+// The file is also recorded by Largest, if it's set, and in the totals by extension
+// for the Breakdown directory if it's in it.
+func (b *Bloat) AddFile(path string, bytes int64) {
+	b.AddFileTime(path, bytes, time.Time{})
+}
+
+// AddFileTime is like AddFile, but also records the time the file was last
+// modified, as the Newest time of its directory and all the parent directories
+// of that directory if it's later than theirs. The file's size is also counted
+// as Reclaimable if it matches one of the Disposable patterns or was last
+// modified before StaleBefore.
+func (b *Bloat) AddFileTime(path string, bytes int64, modified time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	bytes = b.roundUp(bytes)
+	file := &DirInfo{Bytes: bytes, Files: 1, MaxFile: path, MaxFileBytes: bytes, Newest: modified}
+	if b.disposable(path, modified) {
+		file.Reclaimable = bytes
+	}
+	if b.ByExtension {
+		b.addTo(extension(path), file)
+	} else {
+		b.rollUp(path, file)
+		if info, ok := b.DirMap[filepath.Dir(path)]; ok {
+			info.SelfFiles++
+			info.SelfBytes += bytes
+		}
+	}
+	if b.Largest != nil {
+		b.Largest.Add(path, bytes)
+	}
+	if b.Breakdown != "" && b.inBreakdown(path) {
+		if b.breakdown == nil {
+			b.breakdown = make(map[string]*DirInfo)
+		}
+		ext := extension(path)
+		info, ok := b.breakdown[ext]
+		if !ok {
+			info = &DirInfo{Path: ext}
+			b.breakdown[ext] = info
+		}
+		info.merge(file)
+	}
+}
+
+// roundUp rounds the size of a file up to a multiple of BlockSize, if it's set
+func (b *Bloat) roundUp(bytes int64) int64 {
+	if b.BlockSize > 0 && bytes%b.BlockSize != 0 {
+		bytes += b.BlockSize - bytes%b.BlockSize
+	}
+	return bytes
+}
+
+// addFiles adds the totals for some files directly in the directory with the
+// DirMap key dir, as AddFileTime would if they were added one at a time
+func (b *Bloat) addFiles(dir string, totals *DirInfo) {
+	if totals.Files == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rollUpDir(dir, totals)
+	if info, ok := b.DirMap[dir]; ok {
+		info.SelfFiles += totals.Files
+		info.SelfBytes += totals.Bytes
+	}
+}
+
+// inBreakdown reports whether the file at path should be included in the
+// breakdown of the Breakdown directory
+func (b *Bloat) inBreakdown(path string) bool {
+	dir := filepath.Dir(path)
+	if dir == b.Breakdown {
+		return true
+	}
+	if !b.BreakdownRecursive {
+		return false
+	}
+	if b.Breakdown == "." {
+		return !filepath.IsAbs(path) && path != ".." && !strings.HasPrefix(path, ".."+string(filepath.Separator))
+	}
+	return strings.HasPrefix(dir, strings.TrimSuffix(b.Breakdown, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// addDir adds the size of a directory itself to the totals for its parent
+// directories if CountDirs is set, and adds the directory to the DirMap if Empty
+// is set. Directories still aren't counted when totalling by extension, or when
+// only files matching Include patterns, ignored by .gitignore or modified before
+// or after a time are counted.
+func (b *Bloat) addDir(path string, bytes int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.Empty && !b.pruned(path) {
+		b.dirInfo(path)
+	}
+	if b.CountDirs && !b.ByExtension && len(b.Include) == 0 && !b.OnlyIgnored &&
+		b.ModifiedBefore.IsZero() && b.ModifiedAfter.IsZero() {
+		b.rollUp(path, &DirInfo{Bytes: bytes})
+	}
+}
+
+// addTo adds the totals for some files to the totals for a single DirMap key,
+// and to the grand totals
+func (b *Bloat) addTo(key string, totals *DirInfo) {
+	b.TotalBytes += totals.Bytes
+	b.TotalFiles += totals.Files
+	b.dirInfo(key).merge(totals)
+}
+
+// NoExtension is the key which files without an extension are totalled under
+// when totalling by extension
+const NoExtension = "(none)"
+
+// extension returns the extension of the file at path, or NoExtension if it
+// doesn't have one. Hidden files like .profile are considered not to have one.
+func extension(path string) string {
+	name := filepath.Base(path)
+	ext := filepath.Ext(name)
+	if ext == "" || ext == name {
+		return NoExtension
+	}
+	return ext
+}
+
+// rollUp merges the totals for the file or directory at path into the totals for
+// all its parent directories up to the root being scanned, and adds them to the
+// grand totals if it has any. Directories above the root being scanned are left
+// alone, so that only data in the scan roots is reported.
+func (b *Bloat) rollUp(path string, totals *DirInfo) {
+	if path == b.base || filepath.Dir(path) == path {
+		return
+	}
+	b.rollUpDir(filepath.Dir(path), totals)
+}
+
+// rollUpDir adds the totals for some files to the directory with the DirMap key
+// dir, and to its parent directories, as rollUp does
+func (b *Bloat) rollUpDir(dir string, totals *DirInfo) {
+	b.TotalBytes += totals.Bytes
+	b.TotalFiles += totals.Files
+	// In LowMemory mode, skip the directories too deep to be reported.
+	skip := 0
+	if b.LowMemory && b.Depth >= 0 {
+		if d := b.depth(dir); d > b.Depth {
+			skip = d - b.Depth
+		}
+	}
+	// Several of the directories may be totalled under OtherDirs, but the
+	// totals should only be added to it once.
+	other := false
+	for {
+		if skip > 0 {
+			skip--
+		} else if info := b.dirInfo(dir); info.Path != OtherDirs {
+			info.merge(totals)
+		} else if !other {
+			info.merge(totals)
+			other = true
+		}
+		if dir == b.base || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// key returns the DirMap key for a path found while scanning basedir, normalized
+// if NormalizeUnicode is set
+func (b *Bloat) key(basedir string, path string) (string, error) {
+	key, err := b.pathKey(basedir, path)
+	return b.normalize(key), err
+}
+
+// normalize returns name in Unicode normalization form C if NormalizeUnicode is
+// set, or unchanged otherwise
+func (b *Bloat) normalize(name string) string {
+	if !b.NormalizeUnicode {
+		return name
+	}
+	return norm.NFC.String(name)
+}
+
+// pathKey returns the DirMap key for a path found while scanning basedir, before
+// it's normalized
+func (b *Bloat) pathKey(basedir string, path string) (string, error) {
+	if b.RelativeTo != "" {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return "", err
+		}
+		if rel, err := filepath.Rel(b.RelativeTo, abs); err == nil {
+			return rel, nil
+		}
+		return abs, nil
+	}
+	if b.PrefixRoots || b.commandPaths() {
+		return filepath.Clean(path), nil
+	}
+	if b.Abs || b.Compare || b.Summary {
+		return filepath.Abs(path)
+	}
+	return filepath.Rel(basedir, path)
+}
+
+// commandFormat reports whether the selected Format is one whose paths are read
+// by other commands, and so have to be usable from the current directory
+func (b *Bloat) commandFormat() bool {
+	return b.Format == FormatPrint0 || b.Format == FormatDU
+}
+
+// commandPaths reports whether paths are reported as they were found, as with
+// PrefixRoots, because the Format is a commandFormat and none of Abs,
+// RelativeTo, Summary and Compare, which choose how paths are reported
+// themselves, is set
+func (b *Bloat) commandPaths() bool {
+	return b.commandFormat() && !b.Abs && b.RelativeTo == "" && !b.Summary && !b.Compare
+}
+
+// addRoot records the key of a scan root, if it hasn't already been recorded
+func (b *Bloat) addRoot(root string) {
+	if !b.isRoot(root) {
+		b.Roots = append(b.Roots, root)
+	}
+}
+
+// setBase sets the key of the root currently being scanned
+func (b *Bloat) setBase(key string) {
+	b.mu.Lock()
+	b.base = key
+	b.mu.Unlock()
+}
+
+// addLabel records the name to display for the scan root with the specified key,
+// which was scanned as basedir, if it's reported relative to itself or Compare or
+// Summary is set. If the key was used for a root with a different name, as
+// happens when several roots are scanned with relative paths, the key is
+// displayed as it is.
+func (b *Bloat) addLabel(key string, basedir string) {
+	if key != "." && !b.Compare && !b.Summary {
+		return
+	}
+	label := basedir
+	if basedir == "." {
+		if wd, err := os.Getwd(); err == nil {
+			label = filepath.Base(wd)
+		}
+	}
+	if b.labels == nil {
+		b.labels = make(map[string]string)
+	}
+	if old, ok := b.labels[key]; ok && old != label {
+		label = key
+	}
+	b.labels[key] = label
+}
+
+// addTarget records that the scan root with the specified key is a symbolic
+// link to target, so that the target is displayed after the root's name
+func (b *Bloat) addTarget(key string, target string) {
+	label := key
+	if l, ok := b.labels[key]; ok {
+		label = l
+	}
+	if b.labels == nil {
+		b.labels = make(map[string]string)
+	}
+	b.labels[key] = label + " -> " + target
+}
+
+// isRoot reports whether key is the key of a scan root
+func (b *Bloat) isRoot(key string) bool {
+	for _, r := range b.Roots {
+		if r == key {
+			return true
+		}
+	}
+	return false
+}
+
+// pruned reports whether totals aren't kept for dir, because LowMemory is set
+// and it's too deep to be reported
+func (b *Bloat) pruned(dir string) bool {
+	return b.LowMemory && b.Depth >= 0 && b.depth(dir) > b.Depth
+}
+
+// depth returns how many path components dir is below the scan root containing
+// it, or -1 if it isn't under any scan root.
+func (b *Bloat) depth(dir string) int {
+	sep := string(filepath.Separator)
+	for _, root := range b.Roots {
+		if dir == root {
+			return 0
+		}
+		prefix := root
+		if root == "." {
+			prefix = ""
+		} else if !strings.HasSuffix(prefix, sep) {
+			prefix += sep
+		}
+		if strings.HasPrefix(dir, prefix) {
+			return pathDepth(dir[len(prefix):])
+		}
+	}
+	return -1
+}
+
+// pathDepth returns the number of components in path, not counting its volume
+// name, any "." components, or the empty components left by leading, trailing or
+// repeated separators
+func pathDepth(path string) int {
+	n := 0
+	for _, name := range strings.Split(path[len(filepath.VolumeName(path)):], string(filepath.Separator)) {
+		if name != "" && name != "." {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,76 @@
+package bloat
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestPathDepth(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    int
+		windows bool
+	}{
+		{path: "", want: 0},
+		{path: ".", want: 0},
+		{path: "a", want: 1},
+		{path: "a/b/c", want: 3},
+		{path: "./a", want: 1},
+		{path: "./a/./b/", want: 2},
+		{path: "a//b", want: 2},
+		{path: "/", want: 0},
+		{path: "/usr/local/bin", want: 3},
+		{path: "//usr//local/", want: 2},
+		{path: `C:\`, want: 0, windows: true},
+		{path: `C:\Users\bloat`, want: 2, windows: true},
+		{path: `C:Users`, want: 1, windows: true},
+		{path: `\\server\share`, want: 0, windows: true},
+		{path: `\\server\share\dir\sub`, want: 2, windows: true},
+	}
+	for _, tt := range tests {
+		if tt.windows && runtime.GOOS != "windows" {
+			continue
+		}
+		path := filepath.FromSlash(tt.path)
+		if got := pathDepth(path); got != tt.want {
+			t.Errorf("pathDepth(%q) = %d, want %d", path, got, tt.want)
+		}
+	}
+}
+
+func TestPathDepthVolumeName(t *testing.T) {
+	// Whatever the volume name is on this platform, it isn't counted as a
+	// component.
+	path := filepath.Join(filepath.VolumeName(`C:\`)+string(filepath.Separator), "a", "b")
+	if got := pathDepth(path); got != 2 {
+		t.Errorf("pathDepth(%q) = %d, want 2 (volume name %q)", path, got, filepath.VolumeName(path))
+	}
+}
+
+func TestDepth(t *testing.T) {
+	sep := string(filepath.Separator)
+	root := sep + "scan"
+	if runtime.GOOS == "windows" {
+		root = `C:\`
+	}
+	tests := []struct {
+		root string
+		dir  string
+		want int
+	}{
+		{".", ".", 0},
+		{".", "a", 1},
+		{".", filepath.Join("a", "b"), 2},
+		{root, root, 0},
+		{root, filepath.Join(root, "x"), 1},
+		{root, filepath.Join(root, "x", "y"), 2},
+		{root, filepath.Join(sep+"elsewhere", "x"), -1},
+	}
+	for _, tt := range tests {
+		b := &Bloat{Roots: []string{tt.root}}
+		if got := b.depth(tt.dir); got != tt.want {
+			t.Errorf("depth(%q) under %q = %d, want %d", tt.dir, tt.root, got, tt.want)
+		}
+	}
+}
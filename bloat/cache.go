@@ -0,0 +1,80 @@
+package bloat
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// cacheMagic identifies a cache written by SaveCache, and cacheVersion the
+// version of its format, which must be changed whenever the format is
+const (
+	cacheMagic   = "bloat cache"
+	cacheVersion = 1
+)
+
+// cacheHeader starts a cache, so that files which aren't caches, or are caches
+// in another version of the format, can be rejected before reading the rest
+type cacheHeader struct {
+	Magic   string
+	Version int
+}
+
+// cacheData is the scan results saved in a cache
+type cacheData struct {
+	DirMap     map[string]*DirInfo
+	Roots      []string
+	Labels     map[string]string
+	TotalBytes int64
+	TotalFiles int64
+	Started    time.Time
+	Finished   time.Time
+}
+
+// SaveCache writes the totals for the directories scanned to w in a binary format,
+// so that LoadCache can read them back to report on them again without scanning.
+// The individual files aren't saved, so the Largest files, Duplicates and
+// breakdowns by extension aren't available from the cache.
+func (b *Bloat) SaveCache(w io.Writer) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(cacheHeader{Magic: cacheMagic, Version: cacheVersion}); err != nil {
+		return err
+	}
+	return enc.Encode(cacheData{DirMap: b.DirMap, Roots: b.Roots, Labels: b.labels,
+		TotalBytes: b.TotalBytes, TotalFiles: b.TotalFiles, Started: b.started, Finished: b.finished})
+}
+
+// LoadCache reads a cache written by SaveCache, replacing the totals for the
+// directories scanned with those in the cache. It returns an error if r isn't a
+// cache, or is in a format version this version of the package can't read.
+func (b *Bloat) LoadCache(r io.Reader) error {
+	dec := gob.NewDecoder(r)
+	var header cacheHeader
+	if err := dec.Decode(&header); err != nil || header.Magic != cacheMagic {
+		return errors.New("not a bloat cache")
+	}
+	if header.Version != cacheVersion {
+		return fmt.Errorf("unsupported cache format version %d, expected %d", header.Version, cacheVersion)
+	}
+	var data cacheData
+	if err := dec.Decode(&data); err != nil {
+		return err
+	}
+	if data.DirMap == nil {
+		data.DirMap = make(map[string]*DirInfo)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.DirMap = data.DirMap
+	b.Roots = data.Roots
+	b.labels = data.Labels
+	b.TotalBytes = data.TotalBytes
+	b.TotalFiles = data.TotalFiles
+	b.started = data.Started
+	b.finished = data.Finished
+	return nil
+}
@@ -0,0 +1,85 @@
+package bloat
+
+import (
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultDisposable are patterns for the names of files and directories which
+// are commonly safe to clean up: temporary files, logs, caches, backups and
+// build artifacts
+var DefaultDisposable = []string{
+	"*.tmp", "*.temp", "*.log", "*.cache", ".cache", "*.bak", "*~", "*.swp",
+	"*.o", "*.obj", "*.pyc", "__pycache__", "node_modules",
+}
+
+// disposable reports whether the file at path, last modified at modified, looks
+// like it could be cleaned up, according to Disposable and StaleBefore. Only the
+// parts of the path below the root being scanned are matched against the
+// Disposable patterns.
+func (b *Bloat) disposable(path string, modified time.Time) bool {
+	if !b.StaleBefore.IsZero() && !modified.IsZero() && modified.Before(b.StaleBefore) {
+		return true
+	}
+	if len(b.Disposable) == 0 {
+		return false
+	}
+	rel := path
+	if b.base != "" {
+		if r, err := filepath.Rel(b.base, path); err == nil {
+			rel = r
+		}
+	}
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		for _, pat := range b.Disposable {
+			if b.match(pat, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReportCleanup writes a report of the directories which are good candidates for
+// cleaning up, in the same format as Report, with the Reclaimable bytes under
+// each as its size. Nothing is deleted. A directory is a candidate if at least
+// half of the bytes under it are Reclaimable, unless one of its subdirectories is
+// a candidate already accounting for all of them. The candidates with the most
+// Reclaimable bytes are reported first, and only the first Top are reported if
+// Top is greater than zero. Paths are relabelled as for Report.
+func (b *Bloat) ReportCleanup(w io.Writer) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	candidate := func(info *DirInfo) bool {
+		return info.Reclaimable > 0 && info.Reclaimable*2 >= info.Bytes
+	}
+	redundant := make(map[string]bool)
+	for path, info := range b.DirMap {
+		if !candidate(info) {
+			continue
+		}
+		if parent, ok := b.DirMap[filepath.Dir(path)]; ok && parent != info &&
+			candidate(parent) && parent.Reclaimable == info.Reclaimable {
+			redundant[parent.Path] = true
+		}
+	}
+	dirs := []*DirInfo{}
+	for path, info := range b.DirMap {
+		if candidate(info) && !redundant[path] {
+			dirs = append(dirs, &DirInfo{Path: info.Path, Bytes: info.Reclaimable})
+		}
+	}
+	sort.Slice(dirs, func(x, y int) bool {
+		if dirs[x].Bytes != dirs[y].Bytes {
+			return dirs[x].Bytes > dirs[y].Bytes
+		}
+		return dirs[x].Path < dirs[y].Path
+	})
+	if b.Top > 0 && b.Top < len(dirs) {
+		dirs = dirs[:b.Top]
+	}
+	return b.write(w, b.relabel(dirs))
+}
@@ -0,0 +1,85 @@
+//go:build linux
+
+package bloat
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// fsIocFiemap is the FS_IOC_FIEMAP ioctl, which lists the extents a file occupies
+const fsIocFiemap = 0xC020660B
+
+// fiemapExtentLast is set on the last extent of a file
+const fiemapExtentLast = 0x1
+
+// fiemapExtentEncoded is set on extents whose data is encoded, as compressed
+// extents are, in which case their length is the length of the decoded data
+const fiemapExtentEncoded = 0x8
+
+// fiemapExtents is the number of extents asked for with each ioctl
+const fiemapExtents = 64
+
+// fiemap is struct fiemap from linux/fiemap.h, followed by room for the extents
+type fiemap struct {
+	start         uint64
+	length        uint64
+	flags         uint32
+	mappedExtents uint32
+	extentCount   uint32
+	reserved      uint32
+	extents       [fiemapExtents]fiemapExtent
+}
+
+// fiemapExtent is struct fiemap_extent from linux/fiemap.h
+type fiemapExtent struct {
+	logical    uint64
+	physical   uint64
+	length     uint64
+	reserved64 [2]uint64
+	flags      uint32
+	reserved   [3]uint32
+}
+
+// compressedUsage returns the number of bytes the file at path occupies on disk,
+// as the total length of the extents the filesystem reports for it with the
+// FIEMAP ioctl, which leaves out holes. FIEMAP only gives the lengths of encoded
+// extents, such as those compressed by btrfs, once decoded, so files with any
+// fall back to diskUsage, as do files on filesystems which don't support FIEMAP,
+// such as ZFS, and files which aren't regular files or can't be opened. If
+// neither is available, ok is false.
+func compressedUsage(path string, f os.FileInfo) (bytes int64, ok bool) {
+	if !f.Mode().IsRegular() {
+		return diskUsage(f)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return diskUsage(f)
+	}
+	defer file.Close()
+	var fm fiemap
+	for {
+		fm.length = ^uint64(0)
+		fm.extentCount = fiemapExtents
+		fm.mappedExtents = 0
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), fsIocFiemap, uintptr(unsafe.Pointer(&fm)))
+		if errno != 0 {
+			return diskUsage(f)
+		}
+		if fm.mappedExtents == 0 {
+			return bytes, true
+		}
+		for _, e := range fm.extents[:fm.mappedExtents] {
+			if e.flags&fiemapExtentEncoded != 0 {
+				return diskUsage(f)
+			}
+			bytes += int64(e.length)
+		}
+		last := fm.extents[fm.mappedExtents-1]
+		if last.flags&fiemapExtentLast != 0 {
+			return bytes, true
+		}
+		fm.start = last.logical + last.length
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package bloat
+
+import "os"
+
+// compressedUsage returns the number of bytes the file at path occupies on disk.
+// The extents it occupies can't be listed on this platform, so it's the same as
+// diskUsage.
+func compressedUsage(path string, f os.FileInfo) (bytes int64, ok bool) {
+	return diskUsage(f)
+}
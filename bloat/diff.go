@@ -0,0 +1,140 @@
+package bloat
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// DirDelta is the change in size of a directory between two scans. Added is set
+// if the directory is only in the newer scan, and Removed if it's only in the
+// older one.
+type DirDelta struct {
+	Path     string `json:"path"`
+	OldBytes int64  `json:"old_bytes"`
+	NewBytes int64  `json:"new_bytes"`
+	Delta    int64  `json:"delta"`
+	Added    bool   `json:"added,omitempty"`
+	Removed  bool   `json:"removed,omitempty"`
+}
+
+// LoadJSON reads a report written in FormatJSON, ignoring any metadata
+func LoadJSON(r io.Reader) ([]*DirInfo, error) {
+	dirs, _, err := LoadJSONMeta(r)
+	return dirs, err
+}
+
+// Diff matches up the directories from two scans by path, and returns the change
+// in size of each, sorted so the directories which grew the most come first.
+// Directories which are the same size in both are left out.
+func Diff(old []*DirInfo, new []*DirInfo) []DirDelta {
+	olds := make(map[string]*DirInfo, len(old))
+	for _, info := range old {
+		olds[info.Path] = info
+	}
+	var deltas []DirDelta
+	for _, info := range new {
+		d := DirDelta{Path: info.Path, NewBytes: info.Bytes}
+		if o, ok := olds[info.Path]; ok {
+			d.OldBytes = o.Bytes
+			delete(olds, info.Path)
+		} else {
+			d.Added = true
+		}
+		d.Delta = d.NewBytes - d.OldBytes
+		if d.Delta != 0 || d.Added {
+			deltas = append(deltas, d)
+		}
+	}
+	for _, info := range olds {
+		deltas = append(deltas, DirDelta{Path: info.Path, OldBytes: info.Bytes,
+			Delta: -info.Bytes, Removed: true})
+	}
+	sort.Slice(deltas, func(x, y int) bool {
+		if deltas[x].Delta != deltas[y].Delta {
+			return deltas[x].Delta > deltas[y].Delta
+		}
+		return deltas[x].Path < deltas[y].Path
+	})
+	return deltas
+}
+
+// SelectDeltas returns the changes in size of the directories which a report of
+// the scan would include, going by the Depth, MinDepth, NoRoot, ReportMatch,
+// Summary and Compare settings, as Report does. A directory is also left out if
+// its sizes in both scans are below MinSize, or both are above MaxSize. The
+// order of the deltas is kept; ReportDiff applies Top.
+func (b *Bloat) SelectDeltas(deltas []DirDelta) []DirDelta {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	selected := make([]DirDelta, 0, len(deltas))
+	for _, d := range deltas {
+		if b.Summary || b.Compare {
+			if !b.isRoot(d.Path) {
+				continue
+			}
+		} else {
+			if b.Depth >= 0 && b.depth(d.Path) > b.Depth {
+				continue
+			}
+			if b.MinDepth > 0 && b.depth(d.Path) < b.MinDepth {
+				continue
+			}
+			if b.NoRoot && b.aboveRoot(d.Path) {
+				continue
+			}
+			if len(b.ReportMatch) > 0 && !b.reportMatched(d.Path) {
+				continue
+			}
+		}
+		if d.OldBytes < b.MinSize && d.NewBytes < b.MinSize {
+			continue
+		}
+		if b.MaxSize > 0 && d.OldBytes > b.MaxSize && d.NewBytes > b.MaxSize {
+			continue
+		}
+		selected = append(selected, d)
+	}
+	return selected
+}
+
+// ReportDiff writes the changes in size returned by Diff to w, as JSON if Format
+// is FormatJSON, or otherwise as text using the selected Base and Precision. If
+// Top is greater than zero, only that many are written.
+func (b *Bloat) ReportDiff(w io.Writer, deltas []DirDelta) error {
+	if b.Top > 0 && b.Top < len(deltas) {
+		deltas = deltas[:b.Top]
+	}
+	if b.Format == FormatJSON {
+		if deltas == nil {
+			deltas = []DirDelta{}
+		}
+		return json.NewEncoder(w).Encode(deltas)
+	}
+	sizes := make([]string, len(deltas))
+	width := 6
+	for i, d := range deltas {
+		if d.Delta < 0 {
+			sizes[i] = "-" + b.formatSize(-d.Delta)
+		} else {
+			sizes[i] = "+" + b.formatSize(d.Delta)
+		}
+		if len(sizes[i]) > width {
+			width = len(sizes[i])
+		}
+	}
+	for i, d := range deltas {
+		note := ""
+		switch {
+		case d.Added:
+			note = " (added)"
+		case d.Removed:
+			note = " (removed)"
+		}
+		if _, err := fmt.Fprintf(w, "%*s %s%s\n", width, sizes[i], d.Path, note); err != nil {
+			return err
+		}
+	}
+	return nil
+}
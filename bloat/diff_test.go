@@ -0,0 +1,57 @@
+package bloat
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSelectDeltas(t *testing.T) {
+	old := []*DirInfo{
+		{Path: ".", Bytes: 1000},
+		{Path: "a", Bytes: 600},
+		{Path: filepath.Join("a", "b"), Bytes: 500},
+		{Path: "c", Bytes: 400},
+		{Path: "gone", Bytes: 50},
+	}
+	new := []*DirInfo{
+		{Path: ".", Bytes: 3000},
+		{Path: "a", Bytes: 2500},
+		{Path: filepath.Join("a", "b"), Bytes: 2400},
+		{Path: "c", Bytes: 100},
+		{Path: "small", Bytes: 10},
+	}
+	deltas := Diff(old, new)
+	paths := func(deltas []DirDelta) []string {
+		var paths []string
+		for _, d := range deltas {
+			paths = append(paths, d.Path)
+		}
+		return paths
+	}
+	tests := []struct {
+		name      string
+		configure func(*Bloat)
+		want      []string
+	}{
+		{"all", func(b *Bloat) {}, []string{".", "a", filepath.Join("a", "b"), "small", "gone", "c"}},
+		{"depth", func(b *Bloat) { b.Depth = 1 }, []string{".", "a", "small", "gone", "c"}},
+		{"min depth", func(b *Bloat) { b.MinDepth = 2 }, []string{filepath.Join("a", "b")}},
+		{"no root", func(b *Bloat) { b.NoRoot = true }, []string{"a", filepath.Join("a", "b"), "small", "gone", "c"}},
+		{"report match", func(b *Bloat) { b.ReportMatch = []string{"b"} }, []string{filepath.Join("a", "b")}},
+		{"summary", func(b *Bloat) { b.Summary = true }, []string{"."}},
+		// c shrank below the minimum size, but was above it before.
+		{"min size", func(b *Bloat) { b.MinSize = 300 }, []string{".", "a", filepath.Join("a", "b"), "c"}},
+		{"max size", func(b *Bloat) { b.MaxSize = 550 }, []string{filepath.Join("a", "b"), "small", "gone", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBloat(false)
+			b.Roots = []string{"."}
+			tt.configure(b)
+			if got := paths(b.SelectDeltas(deltas)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SelectDeltas = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
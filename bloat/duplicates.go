@@ -0,0 +1,138 @@
+package bloat
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// Duplicates keeps track of the files scanned which are at least MinSize bytes,
+// grouped by size, so that files with identical contents can be found. Files are
+// only read to compare their contents when there's more than one of the same
+// size.
+type Duplicates struct {
+	MinSize int64
+	// Errors collects the errors for files which couldn't be read to compare them
+	Errors []error
+	bySize map[int64][]dupFile
+}
+
+// dupFile is a file recorded by Duplicates, with the path it was found at and
+// its resolved path
+type dupFile struct {
+	path string
+	real string
+}
+
+// DuplicateGroup is a set of files with identical contents
+type DuplicateGroup struct {
+	// Bytes is the size of each of the files
+	Bytes int64    `json:"bytes"`
+	Paths []string `json:"paths"`
+	// Reclaimable is the space that would be freed by keeping only one of them
+	Reclaimable int64 `json:"reclaimable"`
+}
+
+// NewDuplicates returns a Duplicates which looks for duplicates of files of at
+// least minSize bytes
+func NewDuplicates(minSize int64) *Duplicates {
+	return &Duplicates{MinSize: minSize, bySize: make(map[int64][]dupFile)}
+}
+
+// Add records the file found at path, which has the resolved path real, if it's
+// a regular file and isn't too small
+func (d *Duplicates) Add(path string, real string, f os.FileInfo) {
+	bytes := f.Size()
+	if !f.Mode().IsRegular() || bytes < d.MinSize || bytes == 0 {
+		return
+	}
+	d.bySize[bytes] = append(d.bySize[bytes], dupFile{path: path, real: real})
+}
+
+// Groups returns the groups of files recorded which have identical contents,
+// those which would free the most space if deduplicated first. Files which can't
+// be read are left out, and the errors added to Errors.
+func (d *Duplicates) Groups() []DuplicateGroup {
+	var groups []DuplicateGroup
+	for bytes, files := range d.bySize {
+		if len(files) < 2 {
+			continue
+		}
+		byHash := make(map[string][]string)
+		var hashes []string
+		for _, f := range files {
+			sum, err := hashFile(f.real)
+			if err != nil {
+				d.Errors = append(d.Errors, fmt.Errorf("can't read %s: %w", f.path, err))
+				continue
+			}
+			if _, ok := byHash[sum]; !ok {
+				hashes = append(hashes, sum)
+			}
+			byHash[sum] = append(byHash[sum], f.path)
+		}
+		for _, sum := range hashes {
+			if paths := byHash[sum]; len(paths) > 1 {
+				sort.Strings(paths)
+				groups = append(groups, DuplicateGroup{Bytes: bytes, Paths: paths,
+					Reclaimable: bytes * int64(len(paths)-1)})
+			}
+		}
+	}
+	sort.Slice(groups, func(x, y int) bool {
+		if groups[x].Reclaimable != groups[y].Reclaimable {
+			return groups[x].Reclaimable > groups[y].Reclaimable
+		}
+		return groups[x].Paths[0] < groups[y].Paths[0]
+	})
+	return groups
+}
+
+// hashFile returns the SHA-256 hash of the contents of the named file
+func hashFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return string(h.Sum(nil)), nil
+}
+
+// ReportDuplicates writes the groups of duplicate files found by Duplicates, as
+// a JSON array if Format is FormatJSON, or otherwise as text, with sizes in the
+// selected Base and Precision. Errors reading the files are added to Errors.
+func (b *Bloat) ReportDuplicates(w io.Writer) error {
+	groups := b.Duplicates.Groups()
+	b.Errors = append(b.Errors, b.Duplicates.Errors...)
+	b.Duplicates.Errors = nil
+	if b.Format == FormatJSON {
+		if groups == nil {
+			groups = []DuplicateGroup{}
+		}
+		return json.NewEncoder(w).Encode(groups)
+	}
+	for i, g := range groups {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s reclaimable from %d copies of %s:\n", b.formatSize(g.Reclaimable),
+			len(g.Paths), b.formatSize(g.Bytes)); err != nil {
+			return err
+		}
+		for _, p := range g.Paths {
+			if _, err := fmt.Fprintf(w, "  %s\n", b.quote(p)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+//go:build linux
+
+package bloat
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// fastScan scans basedir, whose DirMap key is root, by reading the names in each
+// directory and calling fstatat on them relative to the open directory, which
+// saves looking up each file's full path and building an os.FileInfo for it. It
+// returns errNoFastScan if basedir isn't a directory.
+func (b *Bloat) fastScan(ctx context.Context, basedir string, root string) error {
+	var st unix.Stat_t
+	if err := unix.Lstat(basedir, &st); err != nil {
+		return err
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFDIR {
+		return errNoFastScan
+	}
+	return b.fastDir(ctx, basedir, root, &st)
+}
+
+// fastDir adds the directory at path, with the DirMap key key and the stat
+// information st, and everything under it
+func (b *Bloat) fastDir(ctx context.Context, path string, key string, st *unix.Stat_t) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// As with filepath.Walk, a directory which can't be read isn't counted at
+	// all, and nor is anything in it.
+	dir, err := os.Open(path)
+	var names []string
+	if err == nil {
+		if names, err = dir.Readdirnames(-1); err != nil {
+			dir.Close()
+		}
+	}
+	if err != nil {
+		if b.isRoot(key) {
+			return err
+		}
+		b.skip(path, err)
+		return nil
+	}
+	if b.fastSeen(path, "", st) {
+		dir.Close()
+		b.addScanned(key, b.fastSize(st))
+		return b.skipPath(path, nil, SkipCounted)
+	}
+	b.addDir(key, b.fastSize(st))
+	// Visit the entries in the same order as filepath.Walk, so that the same
+	// link to a file with several is the one counted.
+	sort.Strings(names)
+	fd := int(dir.Fd())
+	stats := make([]unix.Stat_t, len(names))
+	errs := make([]error, len(names))
+	for i, name := range names {
+		st := &stats[i]
+		if errs[i] = unix.Fstatat(fd, name, st, unix.AT_SYMLINK_NOFOLLOW); errs[i] != nil {
+			continue
+		}
+		if st.Mode&unix.S_IFMT == unix.S_IFLNK {
+			// Count links to files using the target's size, as Scan does.
+			var target unix.Stat_t
+			if err := unix.Fstatat(fd, name, &target, 0); err == nil && target.Mode&unix.S_IFMT != unix.S_IFDIR {
+				*st = target
+			}
+		}
+	}
+	// Close the directory before descending into its subdirectories, rather
+	// than keeping one open for every level.
+	dir.Close()
+	// The files are totalled up and added to the directory together, rather
+	// than one at a time, which is where most of the time is saved.
+	files := &DirInfo{}
+	for i, name := range names {
+		switch {
+		case errs[i] != nil:
+			b.skip(filepath.Join(path, name), errs[i])
+		case stats[i].Mode&unix.S_IFMT == unix.S_IFDIR:
+			// Add the files so far first, so that the totals are added in the
+			// same order as Scan adds them.
+			b.addFiles(key, files)
+			files = &DirInfo{}
+			if err := b.fastDir(ctx, filepath.Join(path, name), filepath.Join(key, b.normalize(name)), &stats[i]); err != nil {
+				return err
+			}
+		default:
+			b.fastFile(path, key, name, &stats[i], files)
+		}
+	}
+	b.addFiles(key, files)
+	return nil
+}
+
+// fastFile adds the file name in the directory at path, which has the DirMap
+// key dir, to the totals for the files in it, if it hasn't already been counted.
+// st is the file's stat information. Files which have to be looked at one at a
+// time, to list the largest of them or total them by extension, are added to
+// the DirMap straight away instead.
+func (b *Bloat) fastFile(path string, dir string, name string, st *unix.Stat_t, files *DirInfo) {
+	b.tick()
+	if b.fastSeen(path, name, st) {
+		b.skipPath(filepath.Join(path, name), nil, SkipCounted)
+		return
+	}
+	key := filepath.Join(dir, b.normalize(name))
+	bytes, modified := b.fastSize(st), time.Unix(st.Mtim.Unix())
+	if b.ByExtension || b.Largest != nil || b.Breakdown != "" {
+		b.AddFileTime(key, bytes, modified)
+		return
+	}
+	bytes = b.roundUp(bytes)
+	files.Bytes += bytes
+	files.Files++
+	files.largest(key, bytes)
+	files.touch(modified)
+	if b.disposable(key, modified) {
+		files.Reclaimable += bytes
+	}
+}
+
+// fastSeen is the equivalent of seen for the file name in the directory at path,
+// or the directory at path itself if name is empty, which has the stat
+// information st
+func (b *Bloat) fastSeen(path string, name string, st *unix.Stat_t) bool {
+	if b.CountLinks {
+		return b.seenPath(filepath.Join(path, name))
+	}
+	id := inode{dev: uint64(st.Dev), ino: uint64(st.Ino)}
+	if b.inodes[id] {
+		return true
+	}
+	b.inodes[id] = true
+	return false
+}
+
+// fastSize returns the size to count for a file with the stat information st:
+// the space allocated for it if DiskUsage is set, or otherwise its apparent size
+func (b *Bloat) fastSize(st *unix.Stat_t) int64 {
+	if b.DiskUsage {
+		return st.Blocks * 512
+	}
+	return st.Size
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package bloat
+
+import "context"
+
+// fastScan would scan basedir more quickly than Scan, but there's no faster way
+// on this platform, so it always returns errNoFastScan
+func (b *Bloat) fastScan(ctx context.Context, basedir string, root string) error {
+	return errNoFastScan
+}
@@ -0,0 +1,121 @@
+package bloat
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// makeTree creates a tree of dirs directories, each nested depth deep, with
+// files files of different sizes at each level, and returns its path
+func makeTree(tb testing.TB, dirs int, depth int, files int) string {
+	root := tb.TempDir()
+	for d := 0; d < dirs; d++ {
+		dir := root
+		for l := 0; l < depth; l++ {
+			dir = filepath.Join(dir, fmt.Sprintf("d%d-%d", d, l))
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				tb.Fatal(err)
+			}
+			for f := 0; f < files; f++ {
+				data := make([]byte, (d+1)*(l+1)*(f+1)*37)
+				if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%d.dat", f)), data, 0644); err != nil {
+					tb.Fatal(err)
+				}
+			}
+		}
+	}
+	return root
+}
+
+// scanTree scans root with Fast set or not, and with the other settings made by
+// configure, and returns the Bloat
+func scanTree(tb testing.TB, root string, fast bool, configure func(*Bloat)) *Bloat {
+	b := NewBloat(false)
+	b.Fast = fast
+	if configure != nil {
+		configure(b)
+	}
+	if err := b.Scan(root); err != nil {
+		tb.Fatal(err)
+	}
+	return b
+}
+
+func TestFastMatchesScan(t *testing.T) {
+	root := makeTree(t, 4, 3, 5)
+	extra := filepath.Join(root, "d0-0")
+	// A hard link, a symbolic link to a file and one to a directory, an empty
+	// file and an empty directory.
+	if err := os.Link(filepath.Join(extra, "f4.dat"), filepath.Join(root, "link.dat")); err != nil {
+		t.Fatal(err)
+	}
+	// Creating symbolic links may not be allowed, as on Windows without
+	// developer mode, so the scans are compared without them if so.
+	if err := os.Symlink(filepath.Join(extra, "f3.dat"), filepath.Join(root, "file-link")); err != nil {
+		t.Log(err)
+	}
+	if err := os.Symlink(extra, filepath.Join(root, "dir-link")); err != nil {
+		t.Log(err)
+	}
+	if err := os.WriteFile(filepath.Join(extra, "empty"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "empty-dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		configure func(*Bloat)
+	}{
+		{"default", nil},
+		{"abs", func(b *Bloat) { b.Abs = true }},
+		{"disk usage", func(b *Bloat) { b.DiskUsage = true }},
+		{"count links", func(b *Bloat) { b.CountLinks = true }},
+		{"count dirs", func(b *Bloat) { b.CountDirs = true }},
+		{"empty", func(b *Bloat) { b.Empty = true }},
+		{"low memory", func(b *Bloat) { b.Depth, b.LowMemory = 1, true }},
+		{"block size", func(b *Bloat) { b.BlockSize = 4096 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slow := scanTree(t, root, false, tt.configure)
+			fast := scanTree(t, root, true, tt.configure)
+			if fast.TotalBytes != slow.TotalBytes || fast.TotalFiles != slow.TotalFiles {
+				t.Errorf("fast scan totals = %d bytes in %d files, want %d bytes in %d files",
+					fast.TotalBytes, fast.TotalFiles, slow.TotalBytes, slow.TotalFiles)
+			}
+			if !reflect.DeepEqual(fast.DirMap, slow.DirMap) {
+				for key, info := range slow.DirMap {
+					if got, ok := fast.DirMap[key]; !ok {
+						t.Errorf("fast scan is missing %s", key)
+					} else if !reflect.DeepEqual(got, info) {
+						t.Errorf("fast scan has %s = %+v, want %+v", key, *got, *info)
+					}
+				}
+				for key := range fast.DirMap {
+					if _, ok := slow.DirMap[key]; !ok {
+						t.Errorf("fast scan has extra %s", key)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkScan(b *testing.B) {
+	root := makeTree(b, 50, 4, 50)
+	for _, fast := range []bool{false, true} {
+		name := "normal"
+		if fast {
+			name = "fast"
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				scanTree(b, root, fast, nil)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package bloat
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Fields which can be selected for the text and tree reports with Fields
+const (
+	FieldSize    = "size"
+	FieldPercent = "percent"
+	FieldCount   = "count"
+	FieldAverage = "avg"
+	// FieldSelf is the total size of the files immediately in the directory
+	FieldSelf = "self"
+	// FieldMTime is the modification time of the newest file under the directory
+	FieldMTime = "mtime"
+	// FieldMaxFile is the path of the largest file under the directory
+	FieldMaxFile = "max-file"
+	FieldPath    = "path"
+)
+
+// AllFields lists the fields which can be selected with Fields
+var AllFields = []string{FieldSize, FieldPercent, FieldCount, FieldAverage, FieldSelf, FieldMTime,
+	FieldMaxFile, FieldPath}
+
+// writeFields writes a line of the text report for each directory with the
+// selected Fields, in the order they were given, with each column as wide as it
+// needs to be to line them up. names are the paths to show for the directories.
+func (b *Bloat) writeFields(w io.Writer, dirs []*DirInfo, names []string) error {
+	widths := b.fieldWidths(dirs, names)
+	for i, info := range dirs {
+		if _, err := fmt.Fprintln(w, b.fieldLine(info, names[i], widths)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldWidths returns the width of each of the selected Fields needed to line up
+// the columns for all the directories, and the grand total if GrandTotal is set
+func (b *Bloat) fieldWidths(dirs []*DirInfo, names []string) []int {
+	widths := make([]int, len(b.Fields))
+	measure := func(info *DirInfo, name string) {
+		for i, field := range b.Fields {
+			if n := utf8.RuneCountInString(b.field(field, info, name)); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	for i, info := range dirs {
+		measure(info, names[i])
+	}
+	if b.GrandTotal {
+		measure(&DirInfo{Bytes: b.TotalBytes, Files: b.TotalFiles}, "TOTAL")
+	}
+	return widths
+}
+
+// fieldLine returns the line of the text report for a directory shown as name,
+// with the selected Fields padded to widths. Paths are left aligned and the other
+// fields right aligned, and the last field isn't padded.
+func (b *Bloat) fieldLine(info *DirInfo, name string, widths []int) string {
+	cells := make([]string, len(b.Fields))
+	for i, field := range b.Fields {
+		cell := b.field(field, info, name)
+		pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+		switch {
+		case field == FieldPath || field == FieldMaxFile:
+			if i < len(b.Fields)-1 {
+				cell += pad
+			}
+		default:
+			cell = pad + cell
+		}
+		if field == FieldSize && b.Color {
+			cell = b.colorFor(info.Bytes) + cell + colorReset
+		}
+		cells[i] = cell
+	}
+	return strings.Join(cells, " ")
+}
+
+// field returns the value of a field for a directory shown as name
+func (b *Bloat) field(field string, info *DirInfo, name string) string {
+	switch field {
+	case FieldSize:
+		return b.formatSize(info.Bytes)
+	case FieldPercent:
+		return percent(info.Bytes, b.TotalBytes)
+	case FieldCount:
+		return strconv.FormatInt(info.Files, 10)
+	case FieldAverage:
+		if n, ok := average(info); ok {
+			return b.formatSize(n)
+		}
+	case FieldSelf:
+		return b.formatSize(info.SelfBytes)
+	case FieldMTime:
+		if !info.Newest.IsZero() {
+			return info.Newest.Format("2006-01-02 15:04")
+		}
+	case FieldMaxFile:
+		if info.MaxFile != "" {
+			return b.quote(info.MaxFile)
+		}
+	case FieldPath:
+		return name
+	}
+	return "-"
+}
@@ -0,0 +1,120 @@
+package bloat
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"strings"
+)
+
+// ignoreRule is a single pattern from a .gitignore file
+type ignoreRule struct {
+	// segments is the pattern split at slashes; patterns which can match at any
+	// level below the .gitignore file start with a ** segment
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// ignoreRules holds the patterns from a .gitignore file, in the order they
+// appear in it
+type ignoreRules []ignoreRule
+
+// readIgnoreFile reads the patterns from the named .gitignore file. It returns
+// no patterns and no error if the file doesn't exist.
+func readIgnoreFile(name string) (ignoreRules, error) {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rules ignoreRules
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreLine(scanner.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, scanner.Err()
+}
+
+// parseIgnoreLine parses a line of a .gitignore file, returning false if it's
+// blank or a comment
+func parseIgnoreLine(line string) (ignoreRule, bool) {
+	var rule ignoreRule
+	line = strings.TrimSuffix(line, "\r")
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || line[0] == '#' {
+		return rule, false
+	}
+	if line[0] == '!' {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return rule, false
+	}
+	// A pattern with a slash anywhere but the end is relative to the directory
+	// containing the .gitignore file; otherwise it matches at any level.
+	anchored := strings.Contains(line, "/")
+	rule.segments = strings.Split(strings.TrimPrefix(line, "/"), "/")
+	if !anchored {
+		rule.segments = append([]string{"**"}, rule.segments...)
+	}
+	return rule, true
+}
+
+// match reports whether the path rel, which is slash separated and relative to
+// the directory containing the .gitignore file, is ignored by the last pattern
+// matching it, and whether any pattern matched it at all
+func (rules ignoreRules) match(rel string, isDir bool) (ignored bool, matched bool) {
+	segs := strings.Split(rel, "/")
+	for i := len(rules) - 1; i >= 0; i-- {
+		rule := rules[i]
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if matchSegments(rule.segments, segs) {
+			return !rule.negate, true
+		}
+	}
+	return false, false
+}
+
+// matchSegments reports whether the path segments segs match the pattern
+// segments pat. A ** segment matches any number of path segments, except at the
+// end of a pattern, where it must match at least one.
+func matchSegments(pat []string, segs []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			if len(pat) == 1 {
+				return len(segs) > 0
+			}
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(pat[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], segs[0]); !ok {
+			return false
+		}
+		pat, segs = pat[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
@@ -0,0 +1,98 @@
+package bloat
+
+import (
+	"html/template"
+	"io"
+	"time"
+)
+
+// htmlReport is the data passed to htmlTemplate
+type htmlReport struct {
+	Generated string
+	Total     string
+	Rows      []htmlRow
+}
+
+// htmlRow is a directory in the HTML report. Bar is its size as a percentage of
+// the biggest directory's, for the width of its bar.
+type htmlRow struct {
+	Path    string
+	Bytes   int64
+	Size    string
+	Files   int64
+	Percent string
+	Bar     float64
+}
+
+// htmlTemplate is the self-contained page written for FormatHTML. Clicking on a
+// column heading sorts the table by that column.
+var htmlTemplate = template.Must(template.New("html").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Disk usage report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { padding: 0.2em 0.8em; text-align: left; }
+th { cursor: pointer; border-bottom: 2px solid #888; user-select: none; }
+tr:nth-child(even) td { background: #f4f4f4; }
+td.num { text-align: right; font-variant-numeric: tabular-nums; }
+.bar { width: 12em; }
+.bar div { background: #c0392b; height: 0.8em; }
+</style>
+</head>
+<body>
+<h1>Disk usage report</h1>
+<p>{{.Total}} in total, generated {{.Generated}}.</p>
+<table id="report">
+<thead>
+<tr><th data-type="text">Directory</th><th data-type="number">Size</th><th data-type="number">Files</th><th data-type="number">Percent</th><th data-type="number"></th></tr>
+</thead>
+<tbody>
+{{- range .Rows}}
+<tr><td data-sort="{{.Path}}">{{.Path}}</td><td class="num" data-sort="{{.Bytes}}">{{.Size}}</td><td class="num" data-sort="{{.Files}}">{{.Files}}</td><td class="num" data-sort="{{.Bytes}}">{{.Percent}}</td><td class="bar" data-sort="{{.Bytes}}"><div style="width: {{printf "%.1f" .Bar}}%"></div></td></tr>
+{{- end}}
+</tbody>
+</table>
+<script>
+document.querySelectorAll("#report th").forEach(function (th, col) {
+  var ascending = false;
+  th.addEventListener("click", function () {
+    var body = document.querySelector("#report tbody");
+    var rows = Array.prototype.slice.call(body.rows);
+    var number = th.dataset.type === "number";
+    ascending = !ascending;
+    rows.sort(function (x, y) {
+      var a = x.cells[col].dataset.sort, b = y.cells[col].dataset.sort;
+      var c = number ? a - b : a.localeCompare(b);
+      return ascending ? c : -c;
+    });
+    rows.forEach(function (row) { body.appendChild(row); });
+  });
+});
+</script>
+</body>
+</html>
+`))
+
+// writeHTML writes the directories as a self-contained HTML page, with a table
+// of their sizes which can be sorted by clicking on the headings
+func (b *Bloat) writeHTML(w io.Writer, dirs []*DirInfo) error {
+	report := htmlReport{Generated: time.Now().Format("2006-01-02 15:04:05"), Total: b.formatSize(b.TotalBytes)}
+	var biggest int64
+	for _, info := range dirs {
+		if info.Bytes > biggest {
+			biggest = info.Bytes
+		}
+	}
+	for _, info := range dirs {
+		row := htmlRow{Path: b.display(info.Path), Bytes: info.Bytes, Size: b.formatSize(info.Bytes),
+			Files: info.Files, Percent: percent(info.Bytes, b.TotalBytes)}
+		if biggest > 0 {
+			row.Bar = float64(info.Bytes) * 100 / float64(biggest)
+		}
+		report.Rows = append(report.Rows, row)
+	}
+	return htmlTemplate.Execute(w, report)
+}
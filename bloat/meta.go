@@ -0,0 +1,89 @@
+package bloat
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// ReportMeta describes the scans a report was made from, so that a saved JSON
+// report is self-describing
+type ReportMeta struct {
+	// Started is when the first scan started, and Duration how long it was from
+	// then until the last scan finished
+	Started    time.Time `json:"started"`
+	Duration   float64   `json:"duration_seconds"`
+	TotalBytes int64     `json:"total_bytes"`
+	TotalFiles int64     `json:"total_files"`
+	// Args are the command line arguments the report was made with, if the
+	// caller sets them
+	Args []string `json:"args,omitempty"`
+}
+
+// metaReport is the form of a JSON report with metadata
+type metaReport struct {
+	Meta    *ReportMeta `json:"meta"`
+	Entries []*DirInfo  `json:"entries"`
+}
+
+// timeScan records the time a scan started, if it's the first, and returns a
+// function which records the time it finished
+func (b *Bloat) timeScan() func() {
+	if b.started.IsZero() {
+		b.started = time.Now()
+	}
+	return func() {
+		b.finished = time.Now()
+	}
+}
+
+// Started returns when the first scan started, or the zero time if nothing has
+// been scanned
+func (b *Bloat) Started() time.Time {
+	return b.started
+}
+
+// Elapsed returns how long it was from the start of the first scan to the end of
+// the last one
+func (b *Bloat) Elapsed() time.Duration {
+	return b.finished.Sub(b.started)
+}
+
+// writeJSON writes the directories as a JSON array, or if Meta is set, as an
+// object with Meta, filled in with the times and totals of the scans, under
+// "meta" and the directories under "entries"
+func (b *Bloat) writeJSON(w io.Writer, dirs []*DirInfo) error {
+	if b.Meta == nil {
+		return json.NewEncoder(w).Encode(dirs)
+	}
+	b.Meta.Started = b.started
+	b.Meta.Duration = b.Elapsed().Seconds()
+	b.Meta.TotalBytes = b.TotalBytes
+	b.Meta.TotalFiles = b.TotalFiles
+	if dirs == nil {
+		dirs = []*DirInfo{}
+	}
+	return json.NewEncoder(w).Encode(metaReport{Meta: b.Meta, Entries: dirs})
+}
+
+// LoadJSONMeta reads a report written in FormatJSON, with or without metadata.
+// The metadata is nil if the report doesn't have any.
+func LoadJSONMeta(r io.Reader) ([]*DirInfo, *ReportMeta, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var report metaReport
+		if err := json.NewDecoder(bytes.NewReader(trimmed)).Decode(&report); err != nil {
+			return nil, nil, err
+		}
+		return report.Entries, report.Meta, nil
+	}
+	var dirs []*DirInfo
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&dirs); err != nil {
+		return nil, nil, err
+	}
+	return dirs, nil, nil
+}
@@ -0,0 +1,44 @@
+package bloat
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// progressInterval is the minimum time between updates of the progress line
+const progressInterval = 250 * time.Millisecond
+
+// tick counts a file scanned, and updates the progress line if Progress is set
+// and it hasn't been updated recently
+func (b *Bloat) tick() {
+	b.scanned++
+	if b.Progress == nil {
+		return
+	}
+	now := time.Now()
+	if now.Sub(b.lastProgress) < progressInterval {
+		return
+	}
+	b.lastProgress = now
+	b.mu.Lock()
+	total := b.TotalBytes
+	b.mu.Unlock()
+	line := fmt.Sprintf("%d files scanned, %s", b.scanned, b.formatSize(total))
+	pad := ""
+	if n := b.progressWidth - len(line); n > 0 {
+		pad = strings.Repeat(" ", n)
+	}
+	fmt.Fprintf(b.Progress, "\r%s%s", line, pad)
+	b.progressWidth = len(line)
+}
+
+// endProgress clears the progress line, if one has been written
+func (b *Bloat) endProgress() {
+	if b.Progress == nil || b.progressWidth == 0 {
+		return
+	}
+	fmt.Fprintf(b.Progress, "\r%s\r", strings.Repeat(" ", b.progressWidth))
+	b.progressWidth = 0
+	b.lastProgress = time.Time{}
+}
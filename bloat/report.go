@@ -0,0 +1,715 @@
+package bloat
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lpar/bytesize"
+)
+
+// selected returns the sorted directories which should be output in the report.
+// If Depth is zero or more, directories more than Depth levels below their scan
+// root are left out; their sizes are still included in the totals for their
+// ancestors. Directories less than MinDepth levels below their scan root, and
+// directories smaller than MinSize or bigger than MaxSize, are also left out; if
+// Empty is set, directories with any files under them are left out instead of
+// small ones, and so are directories not matching ReportMatch, if it's set. Their
+// sizes are still included in their ancestors' totals. If Top is
+// greater than zero, only that many of the bloatiest directories are returned,
+// after any beyond CumulativePercent of the total are left out.
+// If NoRoot is set, the scan roots and the directories containing them are left
+// out. If Summary is set, just the scan roots are returned, in the order they were
+// scanned; if Compare is set, just the scan roots are returned, in sorted order.
+func (b *Bloat) selected() []*DirInfo {
+	if b.Summary {
+		return b.roots()
+	}
+	if b.Compare {
+		var dirs []*DirInfo
+		for _, info := range b.Dirs {
+			if b.isRoot(info.Path) {
+				dirs = append(dirs, info)
+			}
+		}
+		return dirs
+	}
+	dirs := make([]*DirInfo, 0, len(b.Dirs))
+	for _, info := range b.Dirs {
+		if b.Depth >= 0 && b.depth(info.Path) > b.Depth {
+			continue
+		}
+		if b.MinDepth > 0 && b.depth(info.Path) < b.MinDepth {
+			continue
+		}
+		if b.Empty {
+			if info.Files > 0 {
+				continue
+			}
+		} else if info.Bytes < b.MinSize || b.MaxSize > 0 && info.Bytes > b.MaxSize {
+			continue
+		}
+		if b.NoRoot && b.aboveRoot(info.Path) {
+			continue
+		}
+		if len(b.ReportMatch) > 0 && !b.reportMatched(info.Path) {
+			continue
+		}
+		dirs = append(dirs, info)
+	}
+	if b.CumulativePercent > 0 {
+		dirs = b.pareto(dirs)
+	}
+	if b.Top > 0 && b.Top < len(dirs) {
+		dirs = dirs[:b.Top]
+	}
+	return dirs
+}
+
+// reportMatched reports whether the path of a directory, or any trailing part of
+// it, matches one of the ReportMatch patterns
+func (b *Bloat) reportMatched(path string) bool {
+	sep := string(filepath.Separator)
+	for {
+		for _, pat := range b.ReportMatch {
+			if b.match(pat, path) {
+				return true
+			}
+		}
+		i := strings.Index(path, sep)
+		if i < 0 {
+			return false
+		}
+		path = path[i+1:]
+	}
+}
+
+// pareto returns the directories up to and including the one which brings their
+// running total to CumulativePercent of the size of the biggest scan root. The
+// scan roots and directories above them aren't added to the running total, and
+// nor are directories inside ones already added, so nothing is counted twice.
+func (b *Bloat) pareto(dirs []*DirInfo) []*DirInfo {
+	var total int64
+	for _, info := range b.roots() {
+		if info.Bytes > total {
+			total = info.Bytes
+		}
+	}
+	target := float64(total) * b.CumulativePercent / 100
+	sep := string(filepath.Separator)
+	var sum int64
+	var counted []string
+	for i, info := range dirs {
+		inside := b.aboveRoot(info.Path)
+		for _, dir := range counted {
+			if strings.HasPrefix(info.Path, dir+sep) {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			sum += info.Bytes
+			counted = append(counted, info.Path)
+			if float64(sum) >= target {
+				return dirs[:i+1]
+			}
+		}
+	}
+	return dirs
+}
+
+// aboveRoot reports whether dir is a scan root or one of the directories
+// containing a scan root
+func (b *Bloat) aboveRoot(dir string) bool {
+	for _, root := range b.Roots {
+		for d := root; ; d = filepath.Dir(d) {
+			if d == dir {
+				return true
+			}
+			if filepath.Dir(d) == d {
+				break
+			}
+		}
+	}
+	return false
+}
+
+// roots returns the DirInfo for each scan root
+func (b *Bloat) roots() []*DirInfo {
+	dirs := make([]*DirInfo, 0, len(b.Roots))
+	for _, root := range b.Roots {
+		info, ok := b.DirMap[root]
+		if !ok {
+			info = &DirInfo{Path: root}
+		}
+		dirs = append(dirs, info)
+	}
+	return dirs
+}
+
+// Report writes the results of the scan to w in the selected Format, with the
+// paths relabelled if RootLabel is set
+func (b *Bloat) Report(w io.Writer) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	dirs := b.relabel(b.selected())
+	if err := b.write(w, dirs); err != nil {
+		return err
+	}
+	if b.GrandTotal {
+		return b.writeTotal(w, dirs)
+	}
+	return nil
+}
+
+// relabel returns dirs with the scan root at the start of their paths replaced
+// by RootLabel, if it's set and the paths aren't for other commands. Otherwise,
+// scan roots with names to display, like the name of a directory scanned as ".",
+// are shown by those names in the formats which don't look them up as each
+// directory is written. The DirInfo for each directory is copied, so the DirMap
+// isn't changed.
+func (b *Bloat) relabel(dirs []*DirInfo) []*DirInfo {
+	if b.commandFormat() {
+		return dirs
+	}
+	names := len(b.labels) > 0 && b.Format != FormatText && b.Format != FormatTree && b.Format != FormatHTML
+	if b.RootLabel == "" && !names {
+		return dirs
+	}
+	labelled := make([]*DirInfo, len(dirs))
+	for i, info := range dirs {
+		c := *info
+		if b.RootLabel != "" {
+			c.Path = b.labelRoot(c.Path)
+			if c.MaxFile != "" {
+				c.MaxFile = b.labelRoot(c.MaxFile)
+			}
+		} else if label, ok := b.labels[c.Path]; ok {
+			c.Path = label
+		}
+		labelled[i] = &c
+	}
+	return labelled
+}
+
+// labelRoot returns path with the scan root it's under replaced by RootLabel, or
+// unchanged if it isn't under any scan root
+func (b *Bloat) labelRoot(path string) string {
+	sep := string(filepath.Separator)
+	for _, root := range b.Roots {
+		if path == root {
+			return b.RootLabel
+		}
+		if root == "." {
+			if !filepath.IsAbs(path) && path != ".." && !strings.HasPrefix(path, ".."+sep) {
+				return b.RootLabel + sep + path
+			}
+			continue
+		}
+		prefix := root
+		if !strings.HasSuffix(prefix, sep) {
+			prefix += sep
+		}
+		if strings.HasPrefix(path, prefix) {
+			return b.RootLabel + sep + path[len(prefix):]
+		}
+	}
+	return path
+}
+
+// writeTotal writes a line with the grand total of everything scanned, for the
+// text and du formats
+func (b *Bloat) writeTotal(w io.Writer, dirs []*DirInfo) error {
+	total := &DirInfo{Path: "TOTAL", Bytes: b.TotalBytes, Files: b.TotalFiles}
+	var err error
+	switch b.Format {
+	case FormatText, FormatTree:
+		if len(b.Fields) > 0 {
+			lines, names := b.names(dirs)
+			_, err = fmt.Fprintln(w, b.fieldLine(total, total.Path, b.fieldWidths(lines, names)))
+			break
+		}
+		_, err = fmt.Fprintf(w, "%s %s\n", b.columns(total, b.sizeWidth(dirs)), total.Path)
+	case FormatDU:
+		_, err = fmt.Fprintf(w, "%d\ttotal\n", total.Bytes)
+	}
+	return err
+}
+
+// ReportBreakdown writes the totals by extension for the files in the Breakdown
+// directory to w in the selected Format, biggest first
+func (b *Bloat) ReportBreakdown(w io.Writer) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	exts := make([]*DirInfo, 0, len(b.breakdown))
+	for _, info := range b.breakdown {
+		exts = append(exts, info)
+	}
+	sort.Slice(exts, func(x, y int) bool {
+		if exts[x].Bytes != exts[y].Bytes {
+			return exts[x].Bytes > exts[y].Bytes
+		}
+		return exts[x].Path < exts[y].Path
+	})
+	return b.write(w, exts)
+}
+
+// write writes dirs to w in the selected Format
+func (b *Bloat) write(w io.Writer, dirs []*DirInfo) error {
+	switch b.Format {
+	case FormatJSON:
+		return b.writeJSON(w, dirs)
+	case FormatJSONLines:
+		return writeJSONLines(w, dirs)
+	case FormatCSV:
+		return b.writeCSV(w, dirs)
+	case FormatTree:
+		return b.writeTree(w, dirs)
+	case FormatPrint0:
+		return writePrint0(w, dirs)
+	case FormatDU:
+		return writeDU(w, dirs)
+	case FormatTemplate:
+		return b.writeTemplate(w, dirs)
+	case FormatPrometheus:
+		return writePrometheus(w, dirs)
+	case FormatHTML:
+		return b.writeHTML(w, dirs)
+	}
+	return b.writeText(w, dirs)
+}
+
+// writeText writes the directories as a text report with the size of each
+func (b *Bloat) writeText(w io.Writer, dirs []*DirInfo) error {
+	lines, names := b.names(dirs)
+	return b.writeLines(w, lines, names)
+}
+
+// names returns the directories in the order the selected Format lists them,
+// and the names to show for them, for the text and tree reports
+func (b *Bloat) names(dirs []*DirInfo) ([]*DirInfo, []string) {
+	if b.Format == FormatTree {
+		return b.treeLines(dirs)
+	}
+	names := make([]string, len(dirs))
+	for i, info := range dirs {
+		names[i] = b.display(info.Path)
+	}
+	return dirs, names
+}
+
+// writeLines writes a line of the text report for each directory, shown as the
+// corresponding name, with the selected Fields if there are any
+func (b *Bloat) writeLines(w io.Writer, dirs []*DirInfo, names []string) error {
+	if len(b.Fields) > 0 {
+		return b.writeFields(w, dirs, names)
+	}
+	width := b.sizeWidth(dirs)
+	for i, info := range dirs {
+		if _, err := fmt.Fprintf(w, "%s %s%s\n", b.columns(info, width), names[i], b.maxFile(info)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// display returns the path to show for a directory in the text report. A scan
+// root reported relative to itself, which would otherwise just be shown as ".",
+// is shown using the name it was scanned with instead. If QuoteNames is set,
+// non-printable characters are escaped.
+func (b *Bloat) display(path string) string {
+	if label, ok := b.labels[path]; ok {
+		path = label
+	}
+	return b.quote(path)
+}
+
+// quote escapes the non-printable characters in a name, and backslashes, using C
+// style escapes if QuoteNames is set
+func (b *Bloat) quote(name string) string {
+	if !b.QuoteNames {
+		return name
+	}
+	var sb strings.Builder
+	for i := 0; i < len(name); {
+		r, size := utf8.DecodeRuneInString(name[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&sb, "\\%03o", name[i])
+		case r == '\\':
+			sb.WriteString(`\\`)
+		case unicode.IsPrint(r):
+			sb.WriteRune(r)
+		case r < utf8.RuneSelf:
+			if esc, ok := cEscapes[r]; ok {
+				sb.WriteString(esc)
+			} else {
+				fmt.Fprintf(&sb, "\\%03o", r)
+			}
+		default:
+			fmt.Fprintf(&sb, "\\u%04x", r)
+		}
+		i += size
+	}
+	return sb.String()
+}
+
+// cEscapes are the C escape sequences for control characters
+var cEscapes = map[rune]string{
+	'\a': `\a`,
+	'\b': `\b`,
+	'\f': `\f`,
+	'\n': `\n`,
+	'\r': `\r`,
+	'\t': `\t`,
+	'\v': `\v`,
+}
+
+// maxFile returns the largest file under a directory and its size, for the end
+// of a line of the text report, if ShowMax is set
+func (b *Bloat) maxFile(info *DirInfo) string {
+	if !b.ShowMax || info.MaxFile == "" {
+		return ""
+	}
+	return fmt.Sprintf("  (largest: %s, %s)", b.quote(info.MaxFile), b.formatSize(info.MaxFileBytes))
+}
+
+// sizeWidth returns the width of the size column needed to line up the sizes of
+// all the directories, and the grand total if GrandTotal is set, which is at
+// least 6
+func (b *Bloat) sizeWidth(dirs []*DirInfo) int {
+	width := 6
+	if b.GrandTotal {
+		width = len(b.formatSize(b.TotalBytes))
+		if width < 6 {
+			width = 6
+		}
+	}
+	for _, info := range dirs {
+		if n := len(b.formatSize(info.Bytes)); n > width {
+			width = n
+		}
+	}
+	return width
+}
+
+// columns returns the size and other columns of the text report for a directory,
+// with the size right aligned to width
+func (b *Bloat) columns(info *DirInfo, width int) string {
+	line := fmt.Sprintf("%*s", width, b.formatSize(info.Bytes))
+	if b.Color {
+		line = b.colorFor(info.Bytes) + line + colorReset
+	}
+	if b.ShowPercent {
+		line += fmt.Sprintf(" %6s", percent(info.Bytes, b.TotalBytes))
+	}
+	if b.ShowCount {
+		line += fmt.Sprintf(" %7d", info.Files)
+	}
+	if b.ShowAverage {
+		avg := "-"
+		if n, ok := average(info); ok {
+			avg = b.formatSize(n)
+		}
+		line += fmt.Sprintf(" %*s", width, avg)
+	}
+	return line
+}
+
+// average returns the average size of the files under a directory, rounded to
+// the nearest byte, or false if there are no files under it
+func average(info *DirInfo) (int64, bool) {
+	if info.Files == 0 {
+		return 0, false
+	}
+	return (info.Bytes + info.Files/2) / info.Files, true
+}
+
+// ANSI escape sequences for coloring sizes
+const (
+	colorRed    = "\x1b[31m"
+	colorYellow = "\x1b[33m"
+	colorGreen  = "\x1b[32m"
+	colorReset  = "\x1b[0m"
+)
+
+// colorFor returns the escape sequence for the color to show a size in
+func (b *Bloat) colorFor(bytes int64) string {
+	switch {
+	case bytes >= b.RedSize:
+		return colorRed
+	case bytes >= b.YellowSize:
+		return colorYellow
+	}
+	return colorGreen
+}
+
+// writeTree writes the directories as a text report with each directory indented
+// under its parent, and only its own name shown. Directories whose parent isn't
+// in the report are shown in full at the top level. Siblings are listed in the
+// order they were sorted in.
+func (b *Bloat) writeTree(w io.Writer, dirs []*DirInfo) error {
+	lines, names := b.treeLines(dirs)
+	return b.writeLines(w, lines, names)
+}
+
+// treeLines returns the directories in the order the tree report lists them,
+// and the names with the branches of the tree to show for them
+func (b *Bloat) treeLines(dirs []*DirInfo) ([]*DirInfo, []string) {
+	listed := make(map[string]bool, len(dirs))
+	for _, info := range dirs {
+		listed[info.Path] = true
+	}
+	children := make(map[string][]*DirInfo)
+	var roots []*DirInfo
+	for _, info := range dirs {
+		parent := filepath.Dir(info.Path)
+		if parent == info.Path || !listed[parent] {
+			roots = append(roots, info)
+			continue
+		}
+		children[parent] = append(children[parent], info)
+	}
+	lines := make([]*DirInfo, 0, len(dirs))
+	names := make([]string, 0, len(dirs))
+	var add func(info *DirInfo, name string, indent string)
+	add = func(info *DirInfo, name string, indent string) {
+		lines = append(lines, info)
+		names = append(names, name)
+		kids := children[info.Path]
+		for i, kid := range kids {
+			branch, next := "├── ", "│   "
+			if i == len(kids)-1 {
+				branch, next = "└── ", "    "
+			}
+			add(kid, indent+branch+b.quote(filepath.Base(kid.Path)), indent+next)
+		}
+	}
+	for _, info := range roots {
+		add(info, b.display(info.Path), "")
+	}
+	return lines, names
+}
+
+// percent formats bytes as a percentage of total
+func percent(bytes int64, total int64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(bytes)*100/float64(total))
+}
+
+// formatSize formats a number of bytes for the text report using the selected
+// Base and Precision
+func (b *Bloat) formatSize(bytes int64) string {
+	if b.GroupDigits {
+		return groupDigits(bytes)
+	}
+	if b.Human {
+		return humanSize(bytes)
+	}
+	if b.Base == 0 {
+		return strconv.FormatInt(bytes, 10)
+	}
+	return bytesize.FormatBytes(bytes, b.Base, b.Precision)
+}
+
+// writePrint0 writes just the path of each directory followed by a NUL byte, for
+// xargs -0. The paths start with the scan roots as they were given to Scan, so
+// they can be used from the current directory.
+func writePrint0(w io.Writer, dirs []*DirInfo) error {
+	for _, info := range dirs {
+		if _, err := fmt.Fprintf(w, "%s\x00", info.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupDigits formats n with a comma between each group of three digits
+func groupDigits(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+	var sb strings.Builder
+	sb.WriteString(sign)
+	for i, c := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+// humanUnits are the suffixes used by humanSize for each power of 1024
+const humanUnits = "KMGTPE"
+
+// humanSize formats a number of bytes the same way as du -h: in powers of 1024
+// with a single letter suffix, rounded up, and with one decimal place if that
+// leaves less than 10 of the unit. Sizes under 1024 are shown as plain numbers.
+func humanSize(bytes int64) string {
+	if bytes < 0 {
+		return "-" + humanSize(-bytes)
+	}
+	if bytes < 1024 {
+		return strconv.FormatInt(bytes, 10)
+	}
+	n := uint64(bytes)
+	for e := 1; ; e++ {
+		div := uint64(1) << (10 * e)
+		q, r := n/div, n%div
+		if q >= 1024 && e < len(humanUnits) {
+			continue
+		}
+		unit := humanUnits[e-1]
+		if tenths := q*10 + (r*10+div-1)/div; tenths < 100 {
+			return fmt.Sprintf("%d.%d%c", tenths/10, tenths%10, unit)
+		}
+		if r > 0 {
+			q++
+		}
+		if q < 1024 || e == len(humanUnits) {
+			return fmt.Sprintf("%d%c", q, unit)
+		}
+	}
+}
+
+// writeJSONLines writes each directory as a JSON object followed by a newline
+func writeJSONLines(w io.Writer, dirs []*DirInfo) error {
+	enc := json.NewEncoder(w)
+	for _, info := range dirs {
+		if err := enc.Encode(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDU writes the size in bytes and path of each directory separated by a
+// tab, in the same format as du -b, with the paths starting with the scan roots
+// as they were given to Scan as du's do
+func writeDU(w io.Writer, dirs []*DirInfo) error {
+	for _, info := range dirs {
+		if _, err := fmt.Fprintf(w, "%d\t%s\n", info.Bytes, info.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prometheusEscaper escapes label values for the Prometheus text format
+var prometheusEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writePrometheus writes the size of each directory as a bloat_directory_bytes
+// gauge in the Prometheus text exposition format, labelled with its path
+func writePrometheus(w io.Writer, dirs []*DirInfo) error {
+	if _, err := fmt.Fprint(w, "# HELP bloat_directory_bytes Total size of the files under the directory.\n"+
+		"# TYPE bloat_directory_bytes gauge\n"); err != nil {
+		return err
+	}
+	for _, info := range dirs {
+		if _, err := fmt.Fprintf(w, "bloat_directory_bytes{path=\"%s\"} %d\n", prometheusEscaper.Replace(info.Path), info.Bytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TemplateEntry is the data passed to Template for each directory. As well as the
+// fields of the DirInfo, HumanBytes is the size formatted for the text report,
+// and Percent is the directory's percentage of TotalBytes.
+type TemplateEntry struct {
+	*DirInfo
+	HumanBytes string
+	Percent    string
+}
+
+// writeTemplate executes Template for each directory, ending each with a newline
+// if the template doesn't
+func (b *Bloat) writeTemplate(w io.Writer, dirs []*DirInfo) error {
+	if b.Template == nil {
+		return fmt.Errorf("no template for the report")
+	}
+	var buf bytes.Buffer
+	for _, info := range dirs {
+		buf.Reset()
+		entry := TemplateEntry{
+			DirInfo:    info,
+			HumanBytes: b.formatSize(info.Bytes),
+			Percent:    percent(info.Bytes, b.TotalBytes),
+		}
+		if err := b.Template.Execute(&buf, entry); err != nil {
+			return err
+		}
+		if buf.Len() == 0 || buf.Bytes()[buf.Len()-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCSV writes the directories as CSV with a path,bytes header row, and a
+// files column as well if ShowCount is set, and max_file and max_file_bytes
+// columns if ShowMax is set
+func (b *Bloat) writeCSV(w io.Writer, dirs []*DirInfo) error {
+	cw := csv.NewWriter(w)
+	header := []string{"path", "bytes"}
+	if b.ShowCount {
+		header = append(header, "files")
+	}
+	if b.ShowAverage {
+		header = append(header, "avg_file_bytes")
+	}
+	if b.ShowMax {
+		header = append(header, "max_file", "max_file_bytes")
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, info := range dirs {
+		row := []string{info.Path, strconv.FormatInt(info.Bytes, 10)}
+		if b.ShowCount {
+			row = append(row, strconv.FormatInt(info.Files, 10))
+		}
+		if b.ShowAverage {
+			avg := ""
+			if n, ok := average(info); ok {
+				avg = strconv.FormatInt(n, 10)
+			}
+			row = append(row, avg)
+		}
+		if b.ShowMax {
+			row = append(row, info.MaxFile, strconv.FormatInt(info.MaxFileBytes, 10))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// FormatSize formats a number of bytes the way the text report shows them
+func (b *Bloat) FormatSize(bytes int64) string {
+	return b.formatSize(bytes)
+}
+
+// DisplayPath returns the path the text report shows for the directory with the
+// DirMap key path
+func (b *Bloat) DisplayPath(path string) string {
+	return b.display(path)
+}
@@ -0,0 +1,207 @@
+package bloat
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+// relTree creates a directory holding a 100 byte file and a subdirectory sub
+// holding a 200 byte file, and returns its path relative to the current
+// directory and its absolute path
+func relTree(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a"), make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "b"), make([]byte, 200), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, err := filepath.Rel(wd, dir)
+	if err != nil {
+		t.Skipf("no relative path to the temporary directory: %v", err)
+	}
+	return rel, dir
+}
+
+// scanReport scans dir with the settings made by configure, and returns the
+// report
+func scanReport(t *testing.T, dir string, configure func(*Bloat)) string {
+	b := NewBloat(false)
+	configure(b)
+	if err := b.Scan(dir); err != nil {
+		t.Fatal(err)
+	}
+	b.Sort(SortSize, false)
+	var buf bytes.Buffer
+	if err := b.Report(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestPrint0Paths(t *testing.T) {
+	rel, abs := relTree(t)
+	tests := []struct {
+		name      string
+		configure func(*Bloat)
+		want      []string
+	}{
+		{"relative", func(b *Bloat) {}, []string{rel, filepath.Join(rel, "sub")}},
+		{"abs", func(b *Bloat) { b.Abs = true }, []string{abs, filepath.Join(abs, "sub")}},
+		{"root label", func(b *Bloat) { b.RootLabel = "label" }, []string{rel, filepath.Join(rel, "sub")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scanReport(t, rel, func(b *Bloat) {
+				b.Format = FormatPrint0
+				tt.configure(b)
+			})
+			if want := strings.Join(tt.want, "\x00") + "\x00"; got != want {
+				t.Errorf("report = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"plain", "plain"},
+		{"new\nline", `new\nline`},
+		{"esc\x1b[31m", `esc\033[31m`},
+		{"del\x7f", `del\177`},
+		{"bad\xffutf8", `bad\377utf8`},
+		{`back\slash`, `back\\slash`},
+		{"café", "café"},
+	}
+	b := &Bloat{QuoteNames: true}
+	for _, tt := range tests {
+		if got := b.quote(tt.name); got != tt.want {
+			t.Errorf("quote(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	b.QuoteNames = false
+	if got := b.quote("new\nline"); got != "new\nline" {
+		t.Errorf("quote without QuoteNames = %q, want it unchanged", got)
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	// The expected values are what du -h --apparent-size shows for files of
+	// these sizes. du never shows negative sizes, which are used for shrinkage
+	// in diffs.
+	tests := []struct {
+		bytes int64
+		want  string
+	}{
+		{0, "0"},
+		{1, "1"},
+		{1023, "1023"},
+		{1024, "1.0K"},
+		{1025, "1.1K"},
+		{1536, "1.5K"},
+		{10239, "10K"},
+		{10240, "10K"},
+		{10241, "11K"},
+		{1048575, "1.0M"},
+		{1048576, "1.0M"},
+		{1048577, "1.1M"},
+		{123456789, "118M"},
+		{1073741824, "1.0G"},
+		{1099511627776, "1.0T"},
+		{-1024, "-1.0K"},
+	}
+	for _, tt := range tests {
+		if got := humanSize(tt.bytes); got != tt.want {
+			t.Errorf("humanSize(%d) = %q, want %q", tt.bytes, got, tt.want)
+		}
+	}
+}
+
+func TestDUPaths(t *testing.T) {
+	rel, abs := relTree(t)
+	tests := []struct {
+		name      string
+		configure func(*Bloat)
+		want      string
+	}{
+		{"relative", func(b *Bloat) {}, "300\t" + rel + "\n200\t" + filepath.Join(rel, "sub") + "\n"},
+		{"abs", func(b *Bloat) { b.Abs = true }, "300\t" + abs + "\n200\t" + filepath.Join(abs, "sub") + "\n"},
+		{"summary", func(b *Bloat) { b.Summary = true }, "300\t" + abs + "\n"},
+		{"grand total", func(b *Bloat) { b.GrandTotal = true },
+			"300\t" + rel + "\n200\t" + filepath.Join(rel, "sub") + "\n300\ttotal\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scanReport(t, rel, func(b *Bloat) {
+				b.Format = FormatDU
+				tt.configure(b)
+			})
+			if got != tt.want {
+				t.Errorf("report = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRootNames(t *testing.T) {
+	_, dir := relTree(t)
+	chdir(t, dir)
+	name := filepath.Base(dir)
+	tests := []struct {
+		name      string
+		configure func(*Bloat)
+		want      string
+	}{
+		{"json", func(b *Bloat) { b.Format = FormatJSON },
+			`[{"path":"` + name + `","bytes":300,"files":2,"self_files":1,"self_bytes":100,"max_file":"` +
+				filepath.Join("sub", "b") + `","max_file_bytes":200},` +
+				`{"path":"sub","bytes":200,"files":1,"self_files":1,"self_bytes":200,"max_file":"` +
+				filepath.Join("sub", "b") + `","max_file_bytes":200}]` + "\n"},
+		{"csv", func(b *Bloat) { b.Format = FormatCSV }, "path,bytes\n" + name + ",300\nsub,200\n"},
+		{"template", func(b *Bloat) {
+			b.Format = FormatTemplate
+			b.Template = template.Must(template.New("").Parse("{{.Path}}={{.Bytes}}"))
+		},
+			name + "=300\nsub=200\n"},
+		{"text", func(b *Bloat) {}, "   300 " + name + "\n   200 sub\n"},
+		{"root label json", func(b *Bloat) { b.Format = FormatJSONLines; b.RootLabel = "label" },
+			`{"path":"label","bytes":300,"files":2,"self_files":1,"self_bytes":100,"max_file":"` +
+				filepath.Join("label", "sub", "b") + `","max_file_bytes":200}` + "\n" +
+				`{"path":"` + filepath.Join("label", "sub") + `","bytes":200,"files":1,"self_files":1,"self_bytes":200,"max_file":"` +
+				filepath.Join("label", "sub", "b") + `","max_file_bytes":200}` + "\n"},
+		{"root label csv", func(b *Bloat) { b.Format = FormatCSV; b.RootLabel = "label" },
+			"path,bytes\nlabel,300\n" + filepath.Join("label", "sub") + ",200\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBloat(false)
+			b.Base = 0
+			tt.configure(b)
+			if err := b.Scan("."); err != nil {
+				t.Fatal(err)
+			}
+			b.Sort(SortSize, false)
+			var buf bytes.Buffer
+			if err := b.Report(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("report = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,651 @@
+package bloat
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// seen reports whether the file at path has already been counted, and records it
+// as counted if it hasn't, so that files are only counted once even if the scan
+// directories overlap. Files are identified by device and inode number where the
+// platform provides them, so that a file with multiple hard links is also only
+// counted once; if CountLinks is set, or inode numbers aren't available, files
+// are identified by absolute path instead.
+func (b *Bloat) seen(path string, f os.FileInfo) bool {
+	if !b.CountLinks {
+		if id, ok := inodeOf(path, f); ok {
+			if b.inodes[id] {
+				return true
+			}
+			b.inodes[id] = true
+			return false
+		}
+	}
+	return b.seenPath(path)
+}
+
+// seenPath is the part of seen which identifies files by absolute path
+func (b *Bloat) seenPath(path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	if b.paths[abs] {
+		return true
+	}
+	b.paths[abs] = true
+	return false
+}
+
+// modified reports whether a file's modification time is within the range set by
+// ModifiedBefore and ModifiedAfter
+func (b *Bloat) modified(f os.FileInfo) bool {
+	t := f.ModTime()
+	if !b.ModifiedBefore.IsZero() && !t.Before(b.ModifiedBefore) {
+		return false
+	}
+	if !b.ModifiedAfter.IsZero() && !t.After(b.ModifiedAfter) {
+		return false
+	}
+	return true
+}
+
+// tooLarge reports whether the file at path is bigger than FileSizeCap, if it's set
+func (b *Bloat) tooLarge(path string, f os.FileInfo) bool {
+	return b.FileSizeCap > 0 && b.size(path, f) > b.FileSizeCap
+}
+
+// size returns the number of bytes to count for the file or directory at path:
+// the result of SizeFunc if it's set, otherwise its apparent size, or the space
+// allocated for it on disk if DiskUsage is set, or taken up by its extents if
+// Compressed is set
+func (b *Bloat) size(path string, f os.FileInfo) int64 {
+	if b.SizeFunc != nil {
+		return b.SizeFunc(path, f)
+	}
+	if b.Compressed {
+		if bytes, ok := compressedUsage(path, f); ok {
+			return bytes
+		}
+	}
+	if b.DiskUsage {
+		if bytes, ok := diskUsage(f); ok {
+			return bytes
+		}
+	}
+	return f.Size()
+}
+
+// excluded reports whether the file or directory with the specified path relative
+// to its scan root matches any of the Exclude patterns. Patterns are matched using
+// filepath.Match against both the base name and the relative path.
+func (b *Bloat) excluded(rel string) bool {
+	return b.matchAny(b.Exclude, rel)
+}
+
+// excludedPath reports whether the absolute path of the file or directory at
+// path is, or is under, any of the ExcludePaths
+func (b *Bloat) excludedPath(path string) bool {
+	if len(b.ExcludePaths) == 0 {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	for _, prefix := range b.ExcludePaths {
+		p, err := filepath.Abs(prefix)
+		if err != nil {
+			continue
+		}
+		if abs == p || strings.HasPrefix(abs, p) && (strings.HasSuffix(p, string(filepath.Separator)) ||
+			abs[len(p)] == filepath.Separator) {
+			return true
+		}
+	}
+	return false
+}
+
+// hidden reports whether a file or directory name is that of a hidden file
+func hidden(name string) bool {
+	return strings.HasPrefix(name, ".") && name != "." && name != ".."
+}
+
+// hiddenPath reports whether any of the elements of path are hidden
+func hiddenPath(path string) bool {
+	for _, name := range strings.Split(filepath.Clean(path), string(filepath.Separator)) {
+		if hidden(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// included reports whether the file with the specified path relative to its scan
+// root should be counted according to the Include patterns, which are matched in
+// the same way as the Exclude patterns. If there are no Include patterns, every
+// file is included.
+func (b *Bloat) included(rel string) bool {
+	return len(b.Include) == 0 || b.matchAny(b.Include, rel)
+}
+
+// matchAny reports whether the base name or the whole of the relative path rel
+// matches any of the glob patterns
+func (b *Bloat) matchAny(patterns []string, rel string) bool {
+	name := filepath.Base(rel)
+	for _, pat := range patterns {
+		if b.match(pat, name) || b.match(pat, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether name matches the glob pattern, ignoring case if
+// IgnoreCase is set. The pattern can contain shell style alternatives in
+// braces, such as "*.{jpg,png}".
+func (b *Bloat) match(pattern string, name string) bool {
+	if b.IgnoreCase {
+		pattern, name = strings.ToLower(pattern), strings.ToLower(name)
+	}
+	for _, pat := range expandBraces(pattern) {
+		if ok, _ := filepath.Match(pat, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// expandBraces returns the patterns a glob pattern stands for once each set of
+// alternatives in braces is replaced by each of the alternatives in turn, so
+// that "*.{jpg,png}" becomes "*.jpg" and "*.png". Braces can't be nested, and
+// ones which aren't closed, or are escaped with a backslash where that's the
+// escape character, are left as they are.
+func expandBraces(pattern string) []string {
+	open := -1
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\' && filepath.Separator != '\\':
+			i++
+		case c == '{':
+			open = i
+		case c == '}' && open >= 0:
+			var patterns []string
+			for _, alt := range strings.Split(pattern[open+1:i], ",") {
+				patterns = append(patterns, expandBraces(pattern[:open]+alt+pattern[i+1:])...)
+			}
+			return patterns
+		}
+	}
+	return []string{pattern}
+}
+
+// Scan walks all files under the specified base dir, and totals their sizes into
+// the Bloat. If Verbose is set, each path is written to the Log as it is
+// visited. Files matching an Exclude pattern aren't counted, and directories
+// matching one are skipped along with everything under them, as are directories
+// under any of the ExcludePaths. Files already counted by an earlier Scan aren't
+// counted again, and nor are files with multiple hard links unless CountLinks is
+// set; directories already scanned are skipped, including those reached again
+// through bind mounts. If OneFileSystem is set, directories on other devices
+// than the base dir aren't descended into. Files modified outside the range set
+// by ModifiedBefore and ModifiedAfter aren't counted, and nor are files which
+// don't match an Include pattern, if there are any, or files bigger than
+// FileSizeCap, if it's set. If NoHidden is set, hidden files and directories
+// are skipped.
+//
+// If GitIgnore is set, files and directories matching the patterns in the
+// .gitignore files found while scanning are skipped; if OnlyIgnored is set,
+// only those files are counted instead.
+//
+// A symbolic link to a file is counted using the size of the target file, as
+// reported by stat; if the target can't be read, the size of the link itself as
+// reported by lstat is used instead. Symbolic links to directories are counted
+// as links unless FollowSymlinks is set, in which case the target directory is
+// scanned as if it were found at the link's path; if FollowTopLevel is set, only
+// links directly in the base dir are followed like that. Links to directories
+// which are already being scanned, including the directories containing them,
+// are skipped. If FollowRoot is set and basedir is itself a symbolic link, the
+// directory it points to is scanned as if it were at basedir.
+//
+// If InspectArchives is set, each zip archive found is also added to the DirMap
+// as a directory, with the uncompressed sizes of the files inside it.
+//
+// Files and directories which can't be read or processed are skipped, and the
+// errors are added to Errors; an error is only returned if the base dir itself
+// can't be scanned.
+func (b *Bloat) Scan(basedir string) error {
+	return b.ScanContext(context.Background(), basedir)
+}
+
+// ScanContext is like Scan, but stops early and returns ctx.Err() if ctx is
+// cancelled. Everything counted before then is kept.
+//
+// If SampleLimit is greater than zero, scanning stops without an error once that
+// many files have been scanned, and Sampled is set; later calls to Scan and
+// ScanList return without scanning anything.
+func (b *Bloat) ScanContext(ctx context.Context, basedir string) error {
+	basedir = filepath.Clean(basedir)
+	if _, err := os.Lstat(basedir); err != nil {
+		var perr *os.PathError
+		if errors.As(err, &perr) {
+			err = perr.Err
+		}
+		return fmt.Errorf("cannot access '%s': %w", basedir, err)
+	}
+	root, err := b.key(basedir, basedir)
+	if err != nil {
+		return fmt.Errorf("can't process %s: %w", basedir, err)
+	}
+	b.addRoot(root)
+	b.addLabel(root, basedir)
+	b.setBase(root)
+	defer b.setBase("")
+	defer b.endProgress()
+	defer b.timeScan()()
+	if b.Fast && b.fastable() {
+		if err := b.fastScan(ctx, basedir, root); err != errNoFastScan {
+			if err != nil {
+				return fmt.Errorf("error scanning %s: %w", basedir, err)
+			}
+			return nil
+		}
+	}
+	s := &scanner{b: b, ctx: ctx, basedir: basedir,
+		ignores: make(map[string]ignoreRules), ignoredDirs: make(map[string]bool)}
+	dir, real := basedir, basedir
+	if b.FollowRoot {
+		if f, err := os.Lstat(basedir); err == nil && f.Mode()&os.ModeSymlink != 0 {
+			if dir, err = realPath(basedir); err != nil {
+				return fmt.Errorf("can't resolve %s: %w", basedir, err)
+			}
+			real = dir
+			b.addTarget(root, dir)
+		}
+	}
+	if b.FollowSymlinks || b.FollowTopLevel {
+		if rp, err := realPath(basedir); err == nil {
+			real = rp
+			b.visited[real] = true
+		}
+	}
+	if err := s.walk(dir, real, basedir); err != nil && err != errSampleLimit {
+		return fmt.Errorf("error scanning %s: %w", basedir, err)
+	}
+	return nil
+}
+
+// errNoFastScan is returned by fastScan if it can't scan a directory, so that
+// the usual scan should be done instead
+var errNoFastScan = errors.New("fast scan not supported")
+
+// fastable reports whether none of the options which fastScan doesn't support
+// are set
+func (b *Bloat) fastable() bool {
+	return len(b.Exclude) == 0 && len(b.ExcludePaths) == 0 && len(b.Include) == 0 && !b.NoHidden &&
+		!b.GitIgnore && !b.OnlyIgnored && b.ModifiedBefore.IsZero() && b.ModifiedAfter.IsZero() &&
+		b.FileSizeCap <= 0 && b.SizeFunc == nil && !b.Compressed && !b.OneFileSystem &&
+		!b.FollowSymlinks && !b.FollowTopLevel && !b.FollowRoot && !b.InspectArchives &&
+		b.Duplicates == nil && !b.Verbose && b.SampleLimit <= 0
+}
+
+// realPath returns the absolute path of a file with all symbolic links resolved
+func realPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// scanner holds the state of a single call to Scan
+type scanner struct {
+	b         *Bloat
+	ctx       context.Context
+	basedir   string
+	rootdev   uint64
+	rootdevok bool
+	// ignores holds the patterns from the .gitignore file in each directory
+	// scanned, and ignoredDirs the directories which they ignore
+	ignores     map[string]ignoreRules
+	ignoredDirs map[string]bool
+}
+
+// errSampleLimit is returned by visit to stop walking once SampleLimit files
+// have been scanned
+var errSampleLimit = errors.New("sample limit reached")
+
+// sampled reports whether SampleLimit files have been scanned, and records it in
+// Sampled if so
+func (b *Bloat) sampled() bool {
+	if b.SampleLimit > 0 && b.scanned >= b.SampleLimit {
+		b.Sampled = true
+	}
+	return b.Sampled
+}
+
+// walk walks the directory tree at dir, which is reached via the path linkdir and
+// has the resolved path real. Paths under dir are processed as if they were under
+// linkdir.
+func (s *scanner) walk(dir string, real string, linkdir string) error {
+	return filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+		if dir == linkdir && dir == real {
+			return s.visit(path, path, path == dir, f, err)
+		}
+		return s.visit(rebase(path, dir, linkdir), rebase(path, dir, real), path == dir, f, err)
+	})
+}
+
+// rebase takes a path found by walking the directory from, and returns the
+// equivalent path under the directory to
+func rebase(path string, from string, to string) string {
+	if path == from {
+		return to
+	}
+	rel := path
+	if from != "." {
+		rel = strings.TrimPrefix(path[len(from):], string(filepath.Separator))
+	}
+	return filepath.Join(to, rel)
+}
+
+// visit processes a single file or directory found by walk. It's passed both the
+// path the file was found at and its resolved path, and whether it's the top of the
+// directory tree being walked.
+func (s *scanner) visit(path string, real string, top bool, f os.FileInfo, err error) error {
+	b := s.b
+	if cerr := s.ctx.Err(); cerr != nil {
+		return cerr
+	}
+	if b.sampled() {
+		return errSampleLimit
+	}
+	if err != nil {
+		if path == s.basedir {
+			return err
+		}
+		b.skip(path, err)
+		return nil
+	}
+	if b.NoHidden && path != s.basedir && hidden(filepath.Base(path)) {
+		return b.skipPath(path, f, SkipHidden)
+	}
+	if len(b.Exclude) > 0 && path != s.basedir {
+		if rel, rerr := filepath.Rel(s.basedir, path); rerr == nil && b.excluded(rel) {
+			return b.skipPath(path, f, SkipExcluded)
+		}
+	}
+	if path != s.basedir && b.excludedPath(path) {
+		return b.skipPath(path, f, SkipExcluded)
+	}
+	if f.Mode()&os.ModeSymlink != 0 {
+		if target, terr := os.Stat(real); terr == nil {
+			if !target.IsDir() {
+				f = target
+			} else if b.FollowSymlinks || b.FollowTopLevel && filepath.Dir(path) == s.basedir {
+				return s.follow(path, real)
+			}
+		}
+	}
+	if f.IsDir() {
+		if b.OneFileSystem {
+			if id, ok := inodeOf(path, f); ok {
+				if path == s.basedir {
+					s.rootdev, s.rootdevok = id.dev, true
+				} else if s.rootdevok && id.dev != s.rootdev {
+					return b.skipPath(path, f, SkipOtherDevice)
+				}
+			}
+		}
+		if (b.FollowSymlinks || b.FollowTopLevel) && !top && b.visited[real] {
+			return b.skipPath(path, f, SkipSymlinkLoop)
+		}
+	}
+	if b.GitIgnore || b.OnlyIgnored {
+		ignored := s.ignored(path, f.IsDir())
+		switch {
+		case ignored && f.IsDir() && !b.OnlyIgnored:
+			return b.skipPath(path, f, SkipIgnored)
+		case ignored && f.IsDir():
+			s.ignoredDirs[path] = true
+		case f.IsDir():
+		case ignored && !b.OnlyIgnored:
+			return b.skipPath(path, f, SkipIgnored)
+		case !ignored && b.OnlyIgnored:
+			return b.skipPath(path, f, SkipNotIgnored)
+		}
+	}
+	if b.Verbose {
+		fmt.Fprintln(b.Log, path)
+	}
+	fdir, err := b.key(s.basedir, path)
+	if err != nil {
+		b.Errors = append(b.Errors, fmt.Errorf("can't process %s: %w", path, err))
+		return b.skipPath(path, f, SkipError)
+	}
+	// Files are matched against Include before they're marked as seen, so that
+	// a hard link with a name which isn't included doesn't stop one with a name
+	// which is from being counted.
+	if !f.IsDir() && len(b.Include) > 0 {
+		if rel, rerr := filepath.Rel(s.basedir, path); rerr != nil || !b.included(rel) {
+			b.tick()
+			return b.skipPath(path, f, SkipNotIncluded)
+		}
+	}
+	if b.seen(real, f) {
+		if f.IsDir() && path != s.basedir {
+			b.addScanned(fdir, b.size(path, f))
+		}
+		return b.skipPath(path, f, SkipCounted)
+	}
+	if f.IsDir() {
+		if (b.GitIgnore || b.OnlyIgnored) && !s.ignoredDirs[path] {
+			s.readIgnores(path, real)
+		}
+		b.addDir(fdir, b.size(path, f))
+		return nil
+	}
+	b.tick()
+	if !b.modified(f) {
+		return b.skipPath(path, f, SkipModified)
+	}
+	if b.tooLarge(path, f) {
+		return b.skipPath(path, f, SkipTooLarge)
+	}
+	b.AddFileTime(fdir, b.size(path, f), f.ModTime())
+	if b.InspectArchives {
+		b.inspectArchive(fdir, real)
+	}
+	if b.Duplicates != nil {
+		b.Duplicates.Add(path, real, f)
+	}
+	return nil
+}
+
+// addScanned adds the totals for the directory at key to its parent directories,
+// if it's the root of an earlier scan, since it's skipped rather than scanned again
+// and wouldn't otherwise be included in them. bytes is the size of the directory
+// itself.
+func (b *Bloat) addScanned(key string, bytes int64) {
+	if !b.isRoot(key) {
+		return
+	}
+	b.mu.Lock()
+	info, ok := b.DirMap[key]
+	if ok {
+		b.rollUp(key, info)
+		b.TotalBytes -= info.Bytes
+		b.TotalFiles -= info.Files
+	}
+	b.mu.Unlock()
+	if ok {
+		b.addDir(key, bytes)
+	}
+}
+
+// readIgnores reads the .gitignore file in the directory at path, if it has one.
+// real is the resolved path of the directory.
+func (s *scanner) readIgnores(path string, real string) {
+	rules, err := readIgnoreFile(filepath.Join(real, ".gitignore"))
+	if err != nil {
+		s.b.skip(filepath.Join(path, ".gitignore"), err)
+		return
+	}
+	if len(rules) > 0 {
+		s.ignores[path] = rules
+	}
+}
+
+// ignored reports whether the file or directory at path is ignored by the
+// .gitignore files read so far, or is in an ignored directory. Patterns in
+// .gitignore files in deeper directories take precedence.
+func (s *scanner) ignored(path string, isDir bool) bool {
+	if path == s.basedir {
+		return false
+	}
+	if s.ignoredDirs[filepath.Dir(path)] {
+		return true
+	}
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if rules, ok := s.ignores[dir]; ok {
+			if rel, err := filepath.Rel(dir, path); err == nil {
+				if ignore, matched := rules.match(filepath.ToSlash(rel), isDir); matched {
+					return ignore
+				}
+			}
+		}
+		if dir == s.basedir || filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	return false
+}
+
+// follow scans the directory which the symbolic link at path points to, unless
+// it's already being scanned. real is the resolved path of the link itself.
+func (s *scanner) follow(path string, real string) error {
+	b := s.b
+	target, err := realPath(real)
+	if err != nil {
+		b.skip(path, err)
+		return nil
+	}
+	for dir := target; ; dir = filepath.Dir(dir) {
+		if b.visited[dir] {
+			if b.Verbose {
+				fmt.Fprintf(b.Log, "skipping %s: link to %s which is already being scanned\n", path, target)
+			}
+			return b.skipPath(path, nil, SkipSymlinkLoop)
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	b.visited[target] = true
+	return s.walk(target, target, path)
+}
+
+// skip records that the file or directory at path was skipped because it
+// couldn't be read
+func (b *Bloat) skip(path string, err error) {
+	b.Errors = append(b.Errors, fmt.Errorf("can't read %s: %w", path, err))
+	b.skipPath(path, nil, SkipError)
+}
+
+// ScanList reads a list of file paths, one per line, and totals their sizes
+// into the Bloat. Paths are kept relative to the current directory unless Abs
+// or RelativeTo is set. Either way the current directory is the scan root, and
+// the totals for the files listed are added to the directories containing them
+// up to it, and no further. Paths which can't be read are skipped, and the errors
+// added to Errors; an error is returned only if the list itself can't be read.
+func (b *Bloat) ScanList(r io.Reader) error {
+	base := "."
+	if b.Abs || b.RelativeTo != "" {
+		var err error
+		if base, err = b.key(".", "."); err != nil {
+			return fmt.Errorf("can't find the current directory: %w", err)
+		}
+	}
+	b.addRoot(base)
+	b.setBase(base)
+	defer b.setBase("")
+	defer b.endProgress()
+	defer b.timeScan()()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if b.sampled() {
+			break
+		}
+		path := scanner.Text()
+		if path == "" {
+			continue
+		}
+		if b.excluded(filepath.Clean(path)) || b.excludedPath(path) {
+			b.skipPath(path, nil, SkipExcluded)
+			continue
+		}
+		if b.NoHidden && hiddenPath(path) {
+			b.skipPath(path, nil, SkipHidden)
+			continue
+		}
+		f, err := os.Lstat(path)
+		if err != nil {
+			b.skip(path, err)
+			continue
+		}
+		if f.Mode()&os.ModeSymlink != 0 {
+			if target, err := os.Stat(path); err == nil && !target.IsDir() {
+				f = target
+			}
+		}
+		if b.Verbose {
+			fmt.Fprintln(b.Log, path)
+		}
+		fdir := b.normalize(filepath.Clean(path))
+		if b.Abs || b.RelativeTo != "" {
+			if fdir, err = b.key(".", path); err != nil {
+				b.Errors = append(b.Errors, fmt.Errorf("can't process %s: %w", path, err))
+				b.skipPath(path, f, SkipError)
+				continue
+			}
+		}
+		if !f.IsDir() && !b.included(filepath.Clean(path)) {
+			b.tick()
+			b.skipPath(path, f, SkipNotIncluded)
+			continue
+		}
+		if b.seen(path, f) {
+			b.skipPath(path, f, SkipCounted)
+			continue
+		}
+		if f.IsDir() {
+			b.addDir(fdir, b.size(path, f))
+			continue
+		}
+		b.tick()
+		switch {
+		case !b.modified(f):
+			b.skipPath(path, f, SkipModified)
+		case b.tooLarge(path, f):
+			b.skipPath(path, f, SkipTooLarge)
+		default:
+			b.AddFileTime(fdir, b.size(path, f), f.ModTime())
+			if b.InspectArchives {
+				b.inspectArchive(fdir, path)
+			}
+			if b.Duplicates != nil {
+				b.Duplicates.Add(path, path, f)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading file list: %w", err)
+	}
+	return nil
+}
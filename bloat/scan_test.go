@@ -0,0 +1,165 @@
+package bloat
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandBraces(t *testing.T) {
+	// Backslashes only escape braces where they aren't the path separator.
+	escapes := filepath.Separator != '\\'
+	tests := []struct {
+		pattern string
+		want    []string
+		escaped bool
+	}{
+		{"*.go", []string{"*.go"}, false},
+		{"*.{jpg,png}", []string{"*.jpg", "*.png"}, false},
+		{"{a,b}.{c,d}", []string{"a.c", "a.d", "b.c", "b.d"}, false},
+		{"x{1,2}y{3,4}z{5,6}", []string{"x1y3z5", "x1y3z6", "x1y4z5", "x1y4z6", "x2y3z5", "x2y3z6", "x2y4z5", "x2y4z6"}, false},
+		{"{only}", []string{"only"}, false},
+		{"{,.bak}", []string{"", ".bak"}, false},
+		{"*.{jpg", []string{"*.{jpg"}, false},
+		{"{a,b}.{c", []string{"a.{c", "b.{c"}, false},
+		{"*.jpg}", []string{"*.jpg}"}, false},
+		{`\{a,b\}`, []string{`\{a,b\}`}, true},
+		{`\{a,b}.{c,d}`, []string{`\{a,b}.c`, `\{a,b}.d`}, true},
+	}
+	for _, tt := range tests {
+		if tt.escaped && !escapes {
+			continue
+		}
+		if got := expandBraces(tt.pattern); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expandBraces(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestMatchBraces(t *testing.T) {
+	escapes := filepath.Separator != '\\'
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+		escaped bool
+	}{
+		{"*.{jpg,png}", "photo.png", true, false},
+		{"*.{jpg,png}", "photo.gif", false, false},
+		{"{a,b}.{c,d}", "b.c", true, false},
+		{"{a,b}.{c,d}", "a.d", true, false},
+		{"{a,b}.{c,d}", "a.e", false, false},
+		{"{a,b}.{c,d}", "c.a", false, false},
+		{"*.{jpg", "x.{jpg", true, false},
+		{"*.{jpg", "x.jpg", false, false},
+		{`\{a,b\}`, "{a,b}", true, true},
+		{`\{a,b\}`, "a", false, true},
+	}
+	b := NewBloat(false)
+	for _, tt := range tests {
+		if tt.escaped && !escapes {
+			continue
+		}
+		if got := b.match(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("match(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+// chdir changes to dir until the end of the test
+func chdir(t *testing.T, dir string) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestScanListAbs(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+	// The temporary directory may be reached through a symbolic link, so the
+	// paths expected are made from the current directory as ScanList sees it.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join("a", "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]int{filepath.Join("a", "f"): 100, filepath.Join("a", "b", "g"): 200}
+	var list strings.Builder
+	for name, size := range files {
+		if err := os.WriteFile(name, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		list.WriteString(name + "\n")
+	}
+	b := NewBloat(true)
+	if err := b.ScanList(strings.NewReader(list.String())); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int64{
+		wd:                          300,
+		filepath.Join(wd, "a"):      300,
+		filepath.Join(wd, "a", "b"): 200,
+	}
+	if len(b.DirMap) != len(want) {
+		var keys []string
+		for key := range b.DirMap {
+			keys = append(keys, key)
+		}
+		t.Errorf("DirMap has %q, want just %d entries", keys, len(want))
+	}
+	for key, bytes := range want {
+		if info, ok := b.DirMap[key]; !ok || info.Bytes != bytes {
+			t.Errorf("DirMap[%q] = %+v, want %d bytes", key, info, bytes)
+		}
+	}
+	if !reflect.DeepEqual(b.Roots, []string{wd}) {
+		t.Errorf("Roots = %q, want %q", b.Roots, []string{wd})
+	}
+	b.Summary = true
+	b.Sort(SortSize, false)
+	if dirs := b.selected(); len(dirs) != 1 || dirs[0].Path != wd || dirs[0].Bytes != 300 {
+		t.Errorf("summary = %+v, want just %s with 300 bytes", dirs, wd)
+	}
+}
+
+func TestCountDirs(t *testing.T) {
+	_, dir := relTree(t)
+	st, err := os.Stat(filepath.Join(dir, "sub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, countDirs := range []bool{false, true} {
+		b := NewBloat(true)
+		b.CountDirs = countDirs
+		if err := b.Scan(dir); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]int64{dir: 300, filepath.Join(dir, "sub"): 200}
+		if countDirs {
+			// The size of sub itself goes to the root, but the size of the root
+			// isn't counted, as it's not in any directory being scanned.
+			want[dir] += st.Size()
+		}
+		for key, bytes := range want {
+			if info, ok := b.DirMap[key]; !ok || info.Bytes != bytes {
+				t.Errorf("with CountDirs %v, DirMap[%q] = %+v, want %d bytes", countDirs, key, info, bytes)
+			}
+		}
+		if b.TotalFiles != 2 {
+			t.Errorf("with CountDirs %v, TotalFiles = %d, want 2", countDirs, b.TotalFiles)
+		}
+	}
+}
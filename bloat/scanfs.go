@@ -0,0 +1,97 @@
+package bloat
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ScanFS is like Scan, but walks the directory root in the file system fsys
+// rather than on disk, so that trees built in memory with testing/fstest.MapFS
+// and the like can be scanned. Paths in fsys are slash separated, as usual for
+// fs.FS; they're reported relative to root, or as they appear in fsys if Abs or
+// PrefixRoots is set. Sizes come from the fs.FileInfo for each entry.
+//
+// The Exclude, Include, NoHidden, ModifiedBefore, ModifiedAfter, FileSizeCap and
+// SampleLimit settings apply as they do for Scan. Symbolic links aren't
+// followed, .gitignore files aren't read, and files aren't checked for having
+// been counted by an earlier scan.
+func (b *Bloat) ScanFS(fsys fs.FS, root string) error {
+	root = path.Clean(root)
+	rootKey := b.fsKey(root, root)
+	b.addRoot(rootKey)
+	b.setBase(rootKey)
+	defer b.setBase("")
+	defer b.endProgress()
+	defer b.timeScan()()
+	err := fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if b.sampled() {
+			return errSampleLimit
+		}
+		if err != nil {
+			if p == root {
+				return err
+			}
+			b.skip(p, err)
+			return nil
+		}
+		rel := filepath.FromSlash(fsRel(root, p))
+		f, err := d.Info()
+		if err != nil {
+			b.skip(p, err)
+			return nil
+		}
+		if p != root && b.NoHidden && hidden(d.Name()) {
+			return b.skipPath(p, f, SkipHidden)
+		}
+		if p != root && b.excluded(rel) {
+			return b.skipPath(p, f, SkipExcluded)
+		}
+		if b.Verbose {
+			fmt.Fprintln(b.Log, p)
+		}
+		key := b.fsKey(root, p)
+		if d.IsDir() {
+			b.addDir(key, b.size(p, f))
+			return nil
+		}
+		b.tick()
+		switch {
+		case !b.modified(f):
+			return b.skipPath(p, f, SkipModified)
+		case b.tooLarge(p, f):
+			return b.skipPath(p, f, SkipTooLarge)
+		case !b.included(rel):
+			return b.skipPath(p, f, SkipNotIncluded)
+		}
+		b.AddFileTime(key, b.size(p, f), f.ModTime())
+		return nil
+	})
+	if err != nil && err != errSampleLimit {
+		return fmt.Errorf("error scanning %s: %w", root, err)
+	}
+	return nil
+}
+
+// fsKey returns the DirMap key for the path p found while scanning root in an
+// fs.FS, normalized if NormalizeUnicode is set
+func (b *Bloat) fsKey(root string, p string) string {
+	if !b.Abs && !b.PrefixRoots && !b.commandPaths() {
+		p = fsRel(root, p)
+	}
+	return b.normalize(filepath.FromSlash(p))
+}
+
+// fsRel returns the path p found while scanning root in an fs.FS relative to
+// root, which is "." for root itself
+func fsRel(root string, p string) string {
+	switch {
+	case p == root:
+		return "."
+	case root == ".":
+		return p
+	}
+	return strings.TrimPrefix(p, root+"/")
+}
@@ -0,0 +1,71 @@
+package bloat
+
+import (
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestScanFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"src/a.go":       {Data: make([]byte, 10)},
+		"src/lib/b.go":   {Data: make([]byte, 20)},
+		".git/objects/o": {Data: make([]byte, 100)},
+		"docs/big.pdf":   {Data: make([]byte, 1000)},
+	}
+	lib := filepath.Join("src", "lib")
+	objects := filepath.Join(".git", "objects")
+	tests := []struct {
+		name      string
+		root      string
+		configure func(*Bloat)
+		want      map[string]int64
+		files     int64
+	}{
+		{"totals", ".", func(b *Bloat) {},
+			map[string]int64{".": 1130, "src": 30, lib: 20, ".git": 100, objects: 100, "docs": 1000}, 4},
+		{"exclude", ".", func(b *Bloat) { b.Exclude = []string{".git"} },
+			map[string]int64{".": 1030, "src": 30, lib: 20, "docs": 1000}, 3},
+		{"include", ".", func(b *Bloat) { b.Include = []string{"*.go"} },
+			map[string]int64{".": 30, "src": 30, lib: 20}, 2},
+		{"file size cap", ".", func(b *Bloat) { b.FileSizeCap = 500 },
+			map[string]int64{".": 130, "src": 30, lib: 20, ".git": 100, objects: 100}, 3},
+		{"no hidden", ".", func(b *Bloat) { b.NoHidden = true },
+			map[string]int64{".": 1030, "src": 30, lib: 20, "docs": 1000}, 3},
+		{"subdirectory", "src", func(b *Bloat) {},
+			map[string]int64{".": 30, "lib": 20}, 2},
+		{"abs", "src", func(b *Bloat) { b.Abs = true },
+			map[string]int64{"src": 30, lib: 20}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBloat(false)
+			tt.configure(b)
+			if err := b.ScanFS(fsys, tt.root); err != nil {
+				t.Fatal(err)
+			}
+			for key, info := range b.DirMap {
+				if want, ok := tt.want[key]; !ok {
+					t.Errorf("DirMap has unexpected %s = %d bytes", key, info.Bytes)
+				} else if info.Bytes != want {
+					t.Errorf("DirMap[%q] = %d bytes, want %d", key, info.Bytes, want)
+				}
+			}
+			for key := range tt.want {
+				if _, ok := b.DirMap[key]; !ok {
+					t.Errorf("DirMap is missing %s", key)
+				}
+			}
+			var rootBytes int64
+			for key, bytes := range tt.want {
+				if b.isRoot(key) {
+					rootBytes = bytes
+				}
+			}
+			if b.TotalBytes != rootBytes || b.TotalFiles != tt.files {
+				t.Errorf("totals = %d bytes in %d files, want %d bytes in %d files",
+					b.TotalBytes, b.TotalFiles, rootBytes, tt.files)
+			}
+		})
+	}
+}
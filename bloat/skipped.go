@@ -0,0 +1,71 @@
+package bloat
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// SkipReason is the reason a file or directory wasn't counted
+type SkipReason int
+
+// Reasons for skipping files and directories
+const (
+	// SkipError means the file or directory couldn't be read; the error is in Errors
+	SkipError SkipReason = iota
+	SkipExcluded
+	SkipHidden
+	SkipIgnored
+	SkipNotIgnored
+	SkipNotIncluded
+	SkipModified
+	SkipTooLarge
+	SkipOtherDevice
+	SkipSymlinkLoop
+	SkipCounted
+)
+
+var skipReasons = [...]string{
+	SkipError:       "couldn't be read",
+	SkipExcluded:    "excluded",
+	SkipHidden:      "hidden",
+	SkipIgnored:     "ignored by .gitignore",
+	SkipNotIgnored:  "not ignored by .gitignore",
+	SkipNotIncluded: "not included",
+	SkipModified:    "modification time out of range",
+	SkipTooLarge:    "larger than the file size cap",
+	SkipOtherDevice: "on a different file system",
+	SkipSymlinkLoop: "link to a directory already being scanned",
+	SkipCounted:     "already counted",
+}
+
+func (r SkipReason) String() string {
+	if r >= 0 && int(r) < len(skipReasons) {
+		return skipReasons[r]
+	}
+	return "unknown"
+}
+
+// SkippedPath records a file or directory which wasn't counted, and why
+type SkippedPath struct {
+	Path   string
+	Reason SkipReason
+}
+
+// Skipped returns the files and directories skipped while scanning, if
+// RecordSkipped is set. Files under a skipped directory aren't listed.
+func (b *Bloat) Skipped() []SkippedPath {
+	return b.skipped
+}
+
+// skipPath records that the file or directory at path was skipped for the
+// specified reason, if RecordSkipped is set, and returns filepath.SkipDir if f is
+// a directory so that walking can skip it
+func (b *Bloat) skipPath(path string, f os.FileInfo, reason SkipReason) error {
+	if b.RecordSkipped {
+		b.skipped = append(b.skipped, SkippedPath{Path: path, Reason: reason})
+	}
+	if f != nil && f.IsDir() {
+		return filepath.SkipDir
+	}
+	return nil
+}
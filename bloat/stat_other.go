@@ -0,0 +1,17 @@
+//go:build !unix && !windows
+
+package bloat
+
+import "os"
+
+// inodeOf returns the device and inode numbers which identify the file at path. They
+// aren't available on this platform, so ok is always false.
+func inodeOf(path string, f os.FileInfo) (id inode, ok bool) {
+	return inode{}, false
+}
+
+// diskUsage returns the number of bytes allocated on disk for the file. It isn't
+// available on this platform, so ok is always false.
+func diskUsage(f os.FileInfo) (bytes int64, ok bool) {
+	return 0, false
+}
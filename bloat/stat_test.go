@@ -0,0 +1,135 @@
+package bloat
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeInfo is an os.FileInfo which didn't come from stat, so its Sys returns nil
+type fakeInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (f fakeInfo) Name() string       { return f.name }
+func (f fakeInfo) Size() int64        { return f.size }
+func (f fakeInfo) ModTime() time.Time { return time.Time{} }
+func (f fakeInfo) IsDir() bool        { return f.dir }
+func (f fakeInfo) Sys() interface{}   { return nil }
+
+func (f fakeInfo) Mode() os.FileMode {
+	if f.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+// missing returns a path under a temporary directory which doesn't exist, so
+// that nothing can be found out about it apart from what's in a fakeInfo
+func missing(t *testing.T, name string) string {
+	return filepath.Join(t.TempDir(), name)
+}
+
+func TestInodeOfNilSys(t *testing.T) {
+	path := missing(t, "file")
+	if id, ok := inodeOf(path, fakeInfo{name: "file", size: 10}); ok {
+		t.Errorf("inodeOf with nil Sys = %v, true, want false", id)
+	}
+}
+
+func TestDiskUsageNilSys(t *testing.T) {
+	if bytes, ok := diskUsage(fakeInfo{name: "file", size: 10}); ok {
+		t.Errorf("diskUsage with nil Sys = %d, true, want false", bytes)
+	}
+	path := missing(t, "file")
+	b := NewBloat(false)
+	b.DiskUsage = true
+	if got := b.size(path, fakeInfo{name: "file", size: 1234}); got != 1234 {
+		t.Errorf("size with DiskUsage and nil Sys = %d, want the apparent size 1234", got)
+	}
+	b.DiskUsage, b.Compressed = false, true
+	if got := b.size(path, fakeInfo{name: "file", size: 1234}); got != 1234 {
+		t.Errorf("size with Compressed and nil Sys = %d, want the apparent size 1234", got)
+	}
+}
+
+func TestSeenNilSys(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "missing-a")
+	c := filepath.Join(dir, "missing-c")
+	f := fakeInfo{name: "file", size: 10}
+	b := NewBloat(false)
+	if b.seen(a, f) {
+		t.Errorf("seen(%q) the first time = true, want false", a)
+	}
+	if !b.seen(a, f) {
+		t.Errorf("seen(%q) the second time = false, want true", a)
+	}
+	// Without inode numbers, a hard link at another path can't be recognized,
+	// so it's counted.
+	if b.seen(c, f) {
+		t.Errorf("seen(%q) = true, want false for a different path", c)
+	}
+}
+
+func TestOneFileSystemNilSys(t *testing.T) {
+	root := missing(t, "root")
+	sub := filepath.Join(root, "sub")
+	b := NewBloat(false)
+	b.OneFileSystem = true
+	s := &scanner{b: b, ctx: context.Background(), basedir: root}
+	if err := s.visit(root, root, true, fakeInfo{name: "root", dir: true}, nil); err != nil {
+		t.Fatalf("visiting the root: %v", err)
+	}
+	if s.rootdevok {
+		t.Errorf("root device recorded from a FileInfo with nil Sys")
+	}
+	if err := s.visit(sub, sub, false, fakeInfo{name: "sub", dir: true}, nil); err != nil {
+		t.Errorf("visiting a subdirectory with nil Sys = %v, want it scanned", err)
+	}
+	file := filepath.Join(sub, "file")
+	if err := s.visit(file, file, false, fakeInfo{name: "file", size: 100}, nil); err != nil {
+		t.Fatalf("visiting a file: %v", err)
+	}
+	if b.TotalBytes != 100 || b.TotalFiles != 1 {
+		t.Errorf("totals = %d bytes in %d files, want 100 bytes in 1 file", b.TotalBytes, b.TotalFiles)
+	}
+}
+
+func TestHardLinkAcrossRoots(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first")
+	second := filepath.Join(dir, "second")
+	for _, d := range []string{first, second} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(first, "data"), make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(first, "data"), filepath.Join(second, "link")); err != nil {
+		t.Skipf("can't make a hard link: %v", err)
+	}
+	for _, countLinks := range []bool{false, true} {
+		b := NewBloat(true)
+		b.CountLinks = countLinks
+		for _, root := range []string{first, second} {
+			if err := b.Scan(root); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want := int64(1)
+		if countLinks {
+			want = 2
+		}
+		if b.TotalFiles != want || b.TotalBytes != want*100 {
+			t.Errorf("with CountLinks %v, totals = %d bytes in %d files, want %d bytes in %d files",
+				countLinks, b.TotalBytes, b.TotalFiles, want*100, want)
+		}
+	}
+}
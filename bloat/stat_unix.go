@@ -0,0 +1,29 @@
+//go:build unix
+
+package bloat
+
+import (
+	"os"
+	"syscall"
+)
+
+// inodeOf returns the device and inode numbers which identify the file at path,
+// from the information already read by stat. If it isn't available, as for a
+// FileInfo which didn't come from stat, ok is false.
+func inodeOf(path string, f os.FileInfo) (id inode, ok bool) {
+	st, ok := f.Sys().(*syscall.Stat_t)
+	if !ok || st == nil {
+		return inode{}, false
+	}
+	return inode{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
+
+// diskUsage returns the number of bytes allocated on disk for the file, based on
+// its count of 512-byte blocks. If the information isn't available, ok is false.
+func diskUsage(f os.FileInfo) (bytes int64, ok bool) {
+	st, ok := f.Sys().(*syscall.Stat_t)
+	if !ok || st == nil {
+		return 0, false
+	}
+	return int64(st.Blocks) * 512, true
+}
@@ -0,0 +1,62 @@
+//go:build unix
+
+package bloat
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// statInfo is a fakeInfo with the device and inode numbers stat would give
+type statInfo struct {
+	fakeInfo
+	st syscall.Stat_t
+}
+
+func (f statInfo) Sys() interface{} { return &f.st }
+
+func TestBindMountedDirScannedOnce(t *testing.T) {
+	// Two paths to the same directory, as for a directory bind mounted inside
+	// the tree being scanned.
+	root := missing(t, "root")
+	dir := filepath.Join(root, "dir")
+	mount := filepath.Join(root, "mount")
+	dirInfo := func(name string) statInfo {
+		return statInfo{fakeInfo: fakeInfo{name: name, dir: true}, st: syscall.Stat_t{Dev: 1, Ino: 42}}
+	}
+	for _, countLinks := range []bool{false, true} {
+		b := NewBloat(false)
+		b.CountLinks = countLinks
+		s := &scanner{b: b, ctx: context.Background(), basedir: root}
+		rootInfo := statInfo{fakeInfo: fakeInfo{name: "root", dir: true}, st: syscall.Stat_t{Dev: 1, Ino: 1}}
+		if err := s.visit(root, root, true, rootInfo, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.visit(dir, dir, false, dirInfo("dir"), nil); err != nil {
+			t.Fatalf("visiting %s the first time: %v", dir, err)
+		}
+		err := s.visit(mount, mount, false, dirInfo("mount"), nil)
+		switch {
+		case countLinks && err != nil:
+			t.Errorf("with CountLinks, visiting %s = %v, want it scanned", mount, err)
+		case !countLinks && err != filepath.SkipDir:
+			t.Errorf("visiting %s = %v, want it skipped", mount, err)
+		}
+	}
+}
+
+func TestHardLinkedFileCountedOnce(t *testing.T) {
+	b := NewBloat(false)
+	file := func(name string) os.FileInfo {
+		return statInfo{fakeInfo: fakeInfo{name: name, size: 10}, st: syscall.Stat_t{Dev: 1, Ino: 7}}
+	}
+	if b.seen(missing(t, "a"), file("a")) {
+		t.Errorf("seen the first link = true, want false")
+	}
+	if !b.seen(missing(t, "b"), file("b")) {
+		t.Errorf("seen another link to the same inode = false, want true")
+	}
+}
@@ -0,0 +1,40 @@
+//go:build windows
+
+package bloat
+
+import (
+	"os"
+	"syscall"
+)
+
+// inodeOf returns the volume serial number and file index which identify the
+// file at path, Windows' equivalents of the device and inode numbers. The file
+// has to be opened to read them; symbolic links are opened rather than their
+// targets. If they can't be read, ok is false.
+func inodeOf(path string, f os.FileInfo) (id inode, ok bool) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return inode{}, false
+	}
+	flags := uint32(syscall.FILE_FLAG_BACKUP_SEMANTICS)
+	if f.Mode()&os.ModeSymlink != 0 {
+		flags |= syscall.FILE_FLAG_OPEN_REPARSE_POINT
+	}
+	h, err := syscall.CreateFile(p, 0, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil, syscall.OPEN_EXISTING, flags, 0)
+	if err != nil {
+		return inode{}, false
+	}
+	defer syscall.CloseHandle(h)
+	var info syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(h, &info); err != nil {
+		return inode{}, false
+	}
+	return inode{dev: uint64(info.VolumeSerialNumber), ino: uint64(info.FileIndexHigh)<<32 | uint64(info.FileIndexLow)}, true
+}
+
+// diskUsage returns the number of bytes allocated on disk for the file. It isn't
+// available on Windows, so ok is always false and the apparent size is used.
+func diskUsage(f os.FileInfo) (bytes int64, ok bool) {
+	return 0, false
+}
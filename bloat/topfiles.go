@@ -0,0 +1,65 @@
+package bloat
+
+import "container/heap"
+
+// LargestFiles keeps track of the N largest individual files added to it, using
+// a min-heap so that memory use stays bounded however many files are added.
+// Each file is recorded as a DirInfo with a Files count of 1, so that the
+// largest files can be reported in the same way as directories.
+type LargestFiles struct {
+	N     int
+	files fileHeap
+}
+
+// NewLargestFiles returns a LargestFiles which keeps the n largest files
+func NewLargestFiles(n int) *LargestFiles {
+	return &LargestFiles{N: n, files: make(fileHeap, 0, n+1)}
+}
+
+// Add records a file, discarding the smallest file recorded if there are then
+// more than N of them
+func (l *LargestFiles) Add(path string, bytes int64) {
+	if len(l.files) == l.N {
+		if l.N == 0 || !l.files.less(l.files[0], &DirInfo{Path: path, Bytes: bytes}) {
+			return
+		}
+	}
+	heap.Push(&l.files, &DirInfo{Path: path, Bytes: bytes, Files: 1})
+	if len(l.files) > l.N {
+		heap.Pop(&l.files)
+	}
+}
+
+// Files returns the files recorded, in no particular order
+func (l *LargestFiles) Files() []*DirInfo {
+	files := make([]*DirInfo, len(l.files))
+	copy(files, l.files)
+	return files
+}
+
+// fileHeap is a heap.Interface with the smallest file at the top. Files of the
+// same size are ordered by path, so which of them are kept is deterministic.
+type fileHeap []*DirInfo
+
+func (h fileHeap) less(x, y *DirInfo) bool {
+	if x.Bytes != y.Bytes {
+		return x.Bytes < y.Bytes
+	}
+	return x.Path > y.Path
+}
+
+func (h fileHeap) Len() int           { return len(h) }
+func (h fileHeap) Less(i, j int) bool { return h.less(h[i], h[j]) }
+func (h fileHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *fileHeap) Push(x interface{}) {
+	*h = append(*h, x.(*DirInfo))
+}
+
+func (h *fileHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
@@ -1,3 +1,10 @@
 module github.com/lpar/bloat
 
-require github.com/lpar/bytesize v1.0.1
+go 1.19
+
+require (
+	github.com/lpar/bytesize v1.0.1
+	golang.org/x/sys v0.5.0
+	golang.org/x/term v0.5.0
+	golang.org/x/text v0.7.0
+)
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lpar/bloat/bloat"
+	"golang.org/x/term"
+)
+
+// browser is the state of the --interactive directory browser
+type browser struct {
+	b *bloat.Bloat
+	// children holds the directories under each directory in the DirMap, biggest
+	// first, with the scan roots under ""
+	children map[string][]*bloat.DirInfo
+	// roots holds the scan roots
+	roots map[string]bool
+	// top is the directory the browser starts in, and can't go above
+	top string
+	// dir is the directory being shown, with cursor the index of the selected
+	// subdirectory and offset the index of the first one on the screen
+	dir    string
+	cursor int
+	offset int
+	// cursors remembers the selection in the directories left, so it's restored
+	// on going back to them
+	cursors map[string]int
+}
+
+// newBrowser returns a browser for the directories scanned into b, rebuilding
+// the hierarchy from their paths
+func newBrowser(b *bloat.Bloat) *browser {
+	br := &browser{b: b, children: make(map[string][]*bloat.DirInfo), roots: make(map[string]bool),
+		cursors: make(map[string]int)}
+	for _, r := range b.Roots {
+		br.roots[r] = true
+	}
+	for path, info := range b.DirMap {
+		parent := br.parent(path)
+		br.children[parent] = append(br.children[parent], info)
+	}
+	for _, dirs := range br.children {
+		sort.Slice(dirs, func(x, y int) bool {
+			if dirs[x].Bytes != dirs[y].Bytes {
+				return dirs[x].Bytes > dirs[y].Bytes
+			}
+			return dirs[x].Path < dirs[y].Path
+		})
+	}
+	if len(br.children[""]) == 1 {
+		br.top = br.children[""][0].Path
+	}
+	br.dir = br.top
+	return br
+}
+
+// parent returns the nearest directory above path which is in the DirMap, or ""
+// if path is a scan root or there isn't one
+func (br *browser) parent(path string) string {
+	for !br.roots[path] {
+		dir := filepath.Dir(path)
+		if dir == path {
+			break
+		}
+		if _, ok := br.b.DirMap[dir]; ok {
+			return dir
+		}
+		path = dir
+	}
+	return ""
+}
+
+// browse runs the interactive browser on the terminal out, reading keys from
+// stdin, until the user quits
+func browse(b *bloat.Bloat, out *os.File) error {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+	// Use the alternate screen, so the terminal is left as it was, and hide the
+	// cursor while browsing.
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+	br := newBrowser(b)
+	key := make([]byte, 8)
+	for {
+		width, height, err := term.GetSize(int(out.Fd()))
+		if err != nil || width <= 0 || height <= 0 {
+			width, height = 80, 24
+		}
+		if _, err := fmt.Fprint(out, br.render(width, height)); err != nil {
+			return err
+		}
+		n, err := os.Stdin.Read(key)
+		if err != nil {
+			return err
+		}
+		switch string(key[:n]) {
+		case "\x1b[A", "k":
+			br.move(-1)
+		case "\x1b[B", "j":
+			br.move(1)
+		case "\x1b[5~":
+			br.move(-(height - 2))
+		case "\x1b[6~":
+			br.move(height - 2)
+		case "\r", "\n", "\x1b[C", "l":
+			br.open()
+		case "\x7f", "\b", "\x1b[D", "h":
+			br.back()
+		case "q", "\x1b", "\x03":
+			return nil
+		}
+	}
+}
+
+// move moves the selection by n entries, stopping at the first and last
+func (br *browser) move(n int) {
+	br.cursor += n
+	if last := len(br.children[br.dir]) - 1; br.cursor > last {
+		br.cursor = last
+	}
+	if br.cursor < 0 {
+		br.cursor = 0
+	}
+}
+
+// open descends into the selected directory, if it has any subdirectories
+func (br *browser) open() {
+	dirs := br.children[br.dir]
+	if len(dirs) == 0 || len(br.children[dirs[br.cursor].Path]) == 0 {
+		return
+	}
+	br.cursors[br.dir] = br.cursor
+	br.dir = dirs[br.cursor].Path
+	br.cursor, br.offset = 0, 0
+}
+
+// back goes up to the directory above the one shown, selecting the directory
+// being left
+func (br *browser) back() {
+	if br.dir == br.top {
+		return
+	}
+	left := br.dir
+	br.dir = br.parent(left)
+	br.cursor, br.offset = br.cursors[br.dir], 0
+	for i, info := range br.children[br.dir] {
+		if info.Path == left {
+			br.cursor = i
+		}
+	}
+}
+
+// render returns the screen for the directory shown, sized to fit a terminal of
+// width by height characters: a heading with the directory and its total, its
+// subdirectories with the selected one highlighted, and a line of help
+func (br *browser) render(width int, height int) string {
+	var sb strings.Builder
+	sb.WriteString(clearScreen)
+	dirs := br.children[br.dir]
+	total := br.b.TotalBytes
+	heading := "all scanned directories"
+	if info, ok := br.b.DirMap[br.dir]; ok {
+		total = info.Bytes
+		heading = br.b.DisplayPath(br.dir)
+	}
+	sb.WriteString(fit(fmt.Sprintf("%s  %s", heading, br.b.FormatSize(total)), width))
+	sb.WriteString("\r\n")
+	rows := height - 2
+	if rows < 1 {
+		rows = 1
+	}
+	if br.cursor < br.offset {
+		br.offset = br.cursor
+	}
+	if br.cursor >= br.offset+rows {
+		br.offset = br.cursor - rows + 1
+	}
+	if len(dirs) == 0 {
+		sb.WriteString("  (no subdirectories)\r\n")
+	}
+	for i := br.offset; i < len(dirs) && i < br.offset+rows; i++ {
+		info := dirs[i]
+		name := br.b.DisplayPath(info.Path)
+		if br.dir != "" {
+			name = filepath.Base(name)
+		}
+		if len(br.children[info.Path]) > 0 {
+			name += string(filepath.Separator)
+		}
+		line := fit(fmt.Sprintf("%10s %s %s", br.b.FormatSize(info.Bytes), bar(info.Bytes, total), name), width)
+		if i == br.cursor {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		sb.WriteString(line)
+		sb.WriteString("\r\n")
+	}
+	sb.WriteString(fmt.Sprintf("\x1b[%d;1H", height))
+	sb.WriteString(fit("up/down select, enter open, backspace back, q quit", width))
+	return sb.String()
+}
+
+// bar returns a bar chart of bytes as a proportion of total
+func bar(bytes int64, total int64) string {
+	const size = 10
+	n := 0
+	if total > 0 {
+		n = int(bytes * size / total)
+	}
+	if n > size {
+		n = size
+	}
+	return "[" + strings.Repeat("#", n) + strings.Repeat(" ", size-n) + "]"
+}
+
+// fit truncates s to at most width characters
+func fit(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width])
+}
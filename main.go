@@ -1,129 +1,914 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
 
+	"github.com/lpar/bloat/bloat"
 	"github.com/lpar/bytesize"
 )
 
-// DirInfo stores the amount of file bloat under a single directory
-type DirInfo struct {
-	Path  string
-	Bytes int64
+// patternList is a flag.Value which collects the values of a repeatable flag
+type patternList []string
+
+func (p *patternList) String() string {
+	return strings.Join(*p, ",")
 }
 
-// Bloat stores the amount of bloat found
-type Bloat struct {
-	DirMap map[string]*DirInfo
-	Dirs   []*DirInfo
-	Abs    bool
+func (p *patternList) Set(s string) error {
+	*p = append(*p, s)
+	return nil
 }
 
-// NewBloat returns
-func NewBloat(absmode bool) *Bloat {
-	return &Bloat{DirMap: make(map[string]*DirInfo), Abs: absmode}
+// options holds the settings parsed from the command line
+type options struct {
+	abs            bool
+	top            int
+	cumulative     float64
+	depth          int
+	lowMemory      bool
+	maxEntries     int
+	minDepth       int
+	minSize        int64
+	maxSize        int64
+	sortBy         string
+	reverse        bool
+	summary        bool
+	compare        bool
+	noRoot         bool
+	empty          bool
+	grandTotal     bool
+	format         string
+	base           int
+	template       *template.Template
+	precision      int
+	human          bool
+	groupDigits    bool
+	meta           bool
+	relativeTo     string
+	prefixRoots    bool
+	rootLabel      string
+	normalize      bool
+	ignoreCase     bool
+	exclude        patternList
+	excludePaths   patternList
+	reportMatch    patternList
+	include        patternList
+	noHidden       bool
+	gitIgnore      bool
+	onlyIgnored    bool
+	showCount      bool
+	showAvg        bool
+	self           bool
+	showPercent    bool
+	showMax        bool
+	fields         []string
+	largest        int
+	duplicates     bool
+	interactive    bool
+	dupMinSize     int64
+	breakdown      string
+	breakdownAll   bool
+	cleanup        bool
+	disposable     patternList
+	stale          time.Duration
+	byExtension    bool
+	olderThan      time.Duration
+	fileSizeCap    int64
+	newerThan      time.Duration
+	countLinks     bool
+	countDirs      bool
+	oneFS          bool
+	followSymlinks bool
+	followRoot     bool
+	followTop      bool
+	archives       bool
+	diskUsage      bool
+	compressed     bool
+	fast           bool
+	blockSize      int64
+	filesFrom      string
+	save           string
+	load           string
+	sinceScan      string
+	output         string
+	verbose        bool
+	noProgress     bool
+	showSkipped    bool
+	sampleLimit    int64
+	maxFiles       int64
+	diff           bool
+	watch          int
+	color          string
+	quoteNames     bool
+	quoteSet       bool
+	redSize        int64
+	yellowSize     int64
 }
 
-// Sort sorts the data in the DirMap map and places it in the Dirs slice,
-// with the biggest bloatiest directories at the top
-func (b *Bloat) Sort() {
-	b.Dirs = make([]*DirInfo, 0, len(b.DirMap))
-	for _, info := range b.DirMap {
-		b.Dirs = append(b.Dirs, info)
+// Settings for --color
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+// parseFlags parses the command line flags, returning the options and the
+// remaining DIR arguments
+func parseFlags(args []string) (*options, []string, error) {
+	o := &options{}
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ExitOnError)
+	fs.Usage = help
+	fs.BoolVar(&o.abs, "abs", false, "report absolute directory paths")
+	fs.BoolVar(&o.prefixRoots, "prefix-roots", false, "report directory paths starting with the DIR they were found under, to keep DIRs apart")
+	fs.BoolVar(&o.normalize, "normalize-unicode", false, "treat directory names which differ only in their Unicode normalization, as can happen with names from macOS, as the same directory")
+	fs.StringVar(&o.rootLabel, "root-label", "", "show `NAME` in place of the DIR at the start of each path in the report")
+	relativeTo := fs.String("relative-to", "", "report directory paths relative to `DIR`, whichever directories are scanned")
+	fs.IntVar(&o.top, "n", 0, "only report the `N` bloatiest directories (0 means all)")
+	fs.Float64Var(&o.cumulative, "cumulative-percent", 0, "stop reporting once the directories reported account for `P` percent of the total")
+	fs.IntVar(&o.top, "top", 0, "same as -n")
+	fs.IntVar(&o.depth, "depth", -1, "only report directories up to `D` levels below the scan roots (-1 means no limit)")
+	fs.IntVar(&o.depth, "max-depth", -1, "same as -depth")
+	fs.IntVar(&o.maxEntries, "max-entries", 0, "only keep totals for `N` directories, and total the rest as (other), to bound memory use (0 means no limit)")
+	fs.BoolVar(&o.lowMemory, "low-memory", false, "with -depth, don't keep totals for deeper directories, to save memory on huge trees")
+	fs.IntVar(&o.minDepth, "min-depth", 0, "only report directories at least `D` levels below the scan roots")
+	minSize := fs.String("min-size", "0", "only report directories of at least `SIZE`, e.g. 10M or 1GB")
+	maxSize := fs.String("max-size", "", "only report directories of at most `SIZE`")
+	fs.BoolVar(&o.summary, "s", false, "only report the total for each DIR")
+	fs.BoolVar(&o.summary, "summary", false, "same as -s")
+	fs.BoolVar(&o.grandTotal, "c", false, "add a grand total of everything scanned to the end of the report")
+	fs.BoolVar(&o.grandTotal, "grand-total", false, "same as -c")
+	fs.BoolVar(&o.empty, "empty", false, "only report empty directories, which have no files under them")
+	fs.BoolVar(&o.compare, "compare", false, "only report the total for each DIR, biggest first, with its percentage of the combined total")
+	fs.BoolVar(&o.noRoot, "no-root", false, "leave the totals for the DIRs themselves out of the report")
+	fs.StringVar(&o.sortBy, "sort", bloat.SortSize, "sort the report by `KEY`, either size, path or mtime")
+	fs.BoolVar(&o.reverse, "r", false, "reverse the sort order, so the smallest directories are reported first")
+	fs.BoolVar(&o.reverse, "reverse", false, "same as -r")
+	jsonp := fs.Bool("json", false, "output the report as a JSON array")
+	fs.BoolVar(&o.meta, "meta", false, "with --json, include the time and duration of the scan, the totals and the arguments in the report")
+	jsonl := fs.Bool("jsonl", false, "output the report as JSON lines, with one JSON object per directory per line")
+	csvp := fs.Bool("csv", false, "output the report as CSV with a header row")
+	duFormat := fs.Bool("du-format", false, "output sizes in bytes and paths separated by a tab, like du -b")
+	tmpl := fs.String("format", "", "output each directory using the Go text/template `TEMPLATE`, e.g. '{{.HumanBytes}}\\t{{.Path}}'; fields are Path, Bytes, Files, MaxFile, MaxFileBytes, HumanBytes and Percent")
+	prometheus := fs.Bool("prometheus", false, "output the sizes as metrics in the Prometheus text format")
+	html := fs.Bool("html", false, "output the report as an HTML page with a table which can be sorted by clicking on its headings")
+	print0 := fs.Bool("print0", false, "output just the paths, each followed by a NUL byte, for xargs -0")
+	tree := fs.Bool("tree", false, "output the report as a tree, with directories indented under their parents")
+	si := fs.Bool("si", false, "show sizes in powers of 1000, e.g. KB and MB (the default)")
+	iec := fs.Bool("iec", false, "show sizes in powers of 1024, e.g. KiB and MiB")
+	rawBytes := fs.Bool("bytes", false, "show sizes as plain numbers of bytes")
+	human := fs.Bool("human", false, "show sizes like du -h, e.g. 4.0K and 234M")
+	fs.BoolVar(human, "h", false, "same as --human")
+	fs.BoolVar(&o.groupDigits, "group-digits", false, "show sizes as numbers of bytes with thousands separators, e.g. 1,234,567")
+	fs.IntVar(&o.precision, "precision", 0, "show sizes with `P` decimal places")
+	fs.StringVar(&o.color, "color", colorAuto, "color sizes by how big they are: `WHEN` is auto (if output is a terminal), always or never")
+	redSize := fs.String("color-red", "1G", "color directories of at least `SIZE` red")
+	yellowSize := fs.String("color-yellow", "100M", "color directories of at least `SIZE` yellow")
+	fs.BoolVar(&o.quoteNames, "quote-names", false, "escape non-printable characters in paths in the text report (the default if output is a terminal)")
+	fs.BoolVar(&o.showCount, "show-count", false, "show the number of files under each directory")
+	fs.BoolVar(&o.self, "self", false, "report the size of the files directly in each directory, not counting its subdirectories")
+	fs.BoolVar(&o.showAvg, "show-avg", false, "show the average size of the files under each directory")
+	fs.BoolVar(&o.showMax, "show-max", false, "show the largest file under each directory")
+	fields := fs.String("fields", "", "show just the comma separated `FIELDS` in the text report, in that order: "+strings.Join(bloat.AllFields, ", "))
+	fs.IntVar(&o.largest, "files", 0, "list the `N` largest individual files instead of directories")
+	fs.BoolVar(&o.duplicates, "find-duplicates", false, "list groups of files with identical contents, and the space that would be freed by removing the copies, instead")
+	dupMinSize := fs.String("duplicates-min-size", "1M", "with --find-duplicates, ignore files smaller than `SIZE`")
+	fs.BoolVar(&o.byExtension, "by-extension", false, "total files by extension instead of by directory")
+	fs.StringVar(&o.breakdown, "breakdown", "", "after the report, total the files directly in `DIR` by extension, with DIR given as it appears in the report")
+	fs.BoolVar(&o.cleanup, "suggest-cleanup", false, "report the directories which look like they could be cleaned up, and how much space that would free, instead")
+	fs.Var(&o.disposable, "disposable", "with --suggest-cleanup, count files matching or in directories matching the glob `PATTERN` as reclaimable (may be repeated; default temporary files, logs, caches and build artifacts)")
+	stale := fs.String("stale", "1y", "with --suggest-cleanup, count files last modified more than `AGE` ago as reclaimable")
+	fs.BoolVar(&o.breakdownAll, "breakdown-recursive", false, "include all the files under the --breakdown DIR, not just those directly in it")
+	fs.BoolVar(&o.showPercent, "percent", false, "show each directory's percentage of the total size scanned")
+	fileSizeCap := fs.String("skip-files-larger-than", "", "leave files bigger than `SIZE` out of the totals (list them with --show-skipped)")
+	olderThan := fs.String("older-than", "", "only count files last modified more than `AGE` ago, e.g. 90d or 6mo")
+	newerThan := fs.String("newer-than", "", "only count files last modified less than `AGE` ago, e.g. 2w")
+	fs.Var(&o.exclude, "exclude", "skip files and directories matching the glob `PATTERN`, which can include alternatives like *.{jpg,png} (may be repeated)")
+	fs.BoolVar(&o.ignoreCase, "ignore-case", false, "match the --exclude, --include, --disposable and --report-match glob patterns without regard to case")
+	fs.Var(&o.excludePaths, "exclude-path", "skip the directory at `PATH` and everything under it (may be repeated)")
+	fs.Var(&o.reportMatch, "report-match", "only report directories whose paths, or the ends of them, match the glob `PATTERN`, e.g. '*/cache'; everything is still counted (may be repeated)")
+	fs.Var(&o.include, "include", "only count files matching the glob `PATTERN` (may be repeated)")
+	fs.BoolVar(&o.noHidden, "no-hidden", false, "skip hidden files and directories, whose names begin with a dot")
+	fs.BoolVar(&o.gitIgnore, "gitignore", false, "skip files and directories ignored by .gitignore files")
+	fs.BoolVar(&o.onlyIgnored, "only-ignored", false, "only count files ignored by .gitignore files")
+	fs.BoolVar(&o.countLinks, "count-links", false, "count files with multiple hard links once per link, and bind mounted directories once per mount point")
+	fs.BoolVar(&o.countDirs, "count-directories-as-files", false, "add the size of each directory itself, as well as the files in it, to the totals for the directories containing it")
+	fs.BoolVar(&o.oneFS, "x", false, "skip directories on different file systems")
+	fs.BoolVar(&o.oneFS, "one-file-system", false, "same as -x")
+	fs.BoolVar(&o.archives, "inspect-archives", false, "report .zip files as directories, with the uncompressed sizes of their contents")
+	fs.BoolVar(&o.followSymlinks, "follow-symlinks", false, "scan the directories symbolic links point to")
+	fs.BoolVar(&o.followTop, "follow-top-level-symlinks", false, "scan the directories symbolic links directly in the DIRs point to, but not deeper ones")
+	fs.BoolVar(&o.followRoot, "follow-root-symlink", false, "scan the directories the scan roots point to if they're symbolic links")
+	fs.BoolVar(&o.diskUsage, "disk-usage", false, "count the disk space allocated to files rather than their apparent sizes")
+	fs.BoolVar(&o.fast, "fast", false, "read file sizes a directory at a time where the platform allows it, which is quicker (Linux only; ignored with options that need each file looked at, such as --exclude)")
+	fs.BoolVar(&o.compressed, "compressed", false, "count the length of files' extents on disk, leaving out holes (Linux only; elsewhere, and for files with compressed extents, the same as --disk-usage, which reflects compression on ZFS but not btrfs)")
+	blockSize := fs.String("block-size", "0", "round each file's size up to a multiple of `SIZE`, e.g. 4K")
+	fs.StringVar(&o.filesFrom, "files-from", "", "read the list of files to total from `FILE` instead of scanning (- for stdin)")
+	fs.StringVar(&o.save, "save", "", "save the totals found to `CACHE` after a complete scan, for --load to report on again")
+	fs.StringVar(&o.load, "load", "", "report on the totals saved in `CACHE` by --save instead of scanning any DIRs")
+	fs.StringVar(&o.sinceScan, "since-scan", "", "scan the DIRs and report how much each directory has grown or shrunk since the scan saved in `CACHE` by --save, which should have been made with the same DIRs and options")
+	fs.BoolVar(&o.diff, "diff", false, "compare two reports saved with --json, given instead of DIRs, and show what changed")
+	fs.IntVar(&o.watch, "watch", 0, "rescan and redisplay the report every `SECONDS` until interrupted")
+	fs.BoolVar(&o.interactive, "interactive", false, "browse the directories found in the terminal instead of writing a report")
+	fs.StringVar(&o.output, "output", "", "write the report to `FILE` instead of stdout")
+	fs.Int64Var(&o.maxFiles, "max-files-per-dir", -1, "warn about directories immediately containing more than `N` files")
+	fs.Int64Var(&o.sampleLimit, "sample-limit", 0, "stop scanning after `N` files, and report the partial totals as an estimate")
+	fs.BoolVar(&o.verbose, "verbose", false, "list each path to stderr as it is scanned")
+	fs.BoolVar(&o.showSkipped, "show-skipped", false, "list the files and directories which weren't counted, and why, to stderr")
+	fs.BoolVar(&o.noProgress, "no-progress", false, "don't show progress on stderr while scanning")
+	flagSet = fs
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "quote-names" {
+			o.quoteSet = true
+		}
+	})
+
+	if *fields != "" {
+		for _, field := range strings.Split(*fields, ",") {
+			field = strings.TrimSpace(field)
+			if !validField(field) {
+				return nil, nil, fmt.Errorf("unknown field %q in --fields, must be one of %s", field, strings.Join(bloat.AllFields, ", "))
+			}
+			o.fields = append(o.fields, field)
+		}
+	}
+	switch o.sortBy {
+	case bloat.SortSize, bloat.SortPath, bloat.SortMTime:
+	default:
+		return nil, nil, fmt.Errorf("unknown sort key %q, must be size, path or mtime", o.sortBy)
+	}
+	var err error
+	if *relativeTo != "" {
+		if o.relativeTo, err = filepath.Abs(*relativeTo); err != nil {
+			return nil, nil, fmt.Errorf("invalid --relative-to %q: %v", *relativeTo, err)
+		}
+	}
+	if o.minSize, err = parseSize(*minSize); err != nil {
+		return nil, nil, fmt.Errorf("invalid --min-size %q: %v", *minSize, err)
+	}
+	if *maxSize != "" {
+		if o.maxSize, err = parseSize(*maxSize); err != nil {
+			return nil, nil, fmt.Errorf("invalid --max-size %q: %v", *maxSize, err)
+		}
+		if o.maxSize < o.minSize {
+			return nil, nil, fmt.Errorf("invalid --max-size %q, must be at least --min-size", *maxSize)
+		}
+	}
+	if o.diff && fs.NArg() != 2 {
+		return nil, nil, fmt.Errorf("--diff needs an old and a new JSON report file")
+	}
+	if o.watch < 0 {
+		return nil, nil, fmt.Errorf("invalid --watch %d, must not be negative", o.watch)
+	}
+	if o.load != "" && (fs.NArg() > 0 || o.filesFrom != "" || o.diff || o.save != "") {
+		return nil, nil, fmt.Errorf("--load can't be used with DIRs, --files-from, --diff or --save")
+	}
+	if o.load != "" && (o.largest > 0 || o.duplicates || o.breakdown != "") {
+		return nil, nil, fmt.Errorf("--load can't be used with --files, --find-duplicates or --breakdown, as the cache only holds directory totals")
+	}
+	if o.sinceScan != "" && (o.load != "" || o.diff || o.watch > 0 || o.interactive) {
+		return nil, nil, fmt.Errorf("--since-scan can't be used with --load, --diff, --watch or --interactive")
+	}
+	if o.sinceScan != "" && (o.largest > 0 || o.duplicates || o.cleanup || o.breakdown != "" || o.empty || o.cumulative > 0) {
+		return nil, nil, fmt.Errorf("--since-scan can't be used with --files, --find-duplicates, --suggest-cleanup, --breakdown, --empty or --cumulative-percent")
+	}
+	if o.save != "" && o.diff {
+		return nil, nil, fmt.Errorf("--save can't be used with --diff")
+	}
+	if o.watch > 0 && (o.filesFrom != "" || o.diff || o.load != "" || o.save != "") {
+		return nil, nil, fmt.Errorf("--watch can't be used with --files-from, --diff, --save or --load")
+	}
+	if o.interactive && (o.watch > 0 || o.diff || o.output != "") {
+		return nil, nil, fmt.Errorf("--interactive can't be used with --watch, --diff or --output")
+	}
+	if o.gitIgnore && o.onlyIgnored {
+		return nil, nil, fmt.Errorf("--gitignore and --only-ignored can't be used together")
+	}
+	switch o.color {
+	case colorAuto, colorAlways, colorNever:
+	default:
+		return nil, nil, fmt.Errorf("unknown --color %q, must be auto, always or never", o.color)
+	}
+	if o.redSize, err = parseSize(*redSize); err != nil {
+		return nil, nil, fmt.Errorf("invalid --color-red %q: %v", *redSize, err)
+	}
+	if o.yellowSize, err = parseSize(*yellowSize); err != nil {
+		return nil, nil, fmt.Errorf("invalid --color-yellow %q: %v", *yellowSize, err)
+	}
+	if *fileSizeCap != "" {
+		if o.fileSizeCap, err = parseSize(*fileSizeCap); err != nil {
+			return nil, nil, fmt.Errorf("invalid --skip-files-larger-than %q: %v", *fileSizeCap, err)
+		}
+	}
+	if *olderThan != "" {
+		if o.olderThan, err = parseAge(*olderThan); err != nil {
+			return nil, nil, fmt.Errorf("invalid --older-than %q: %v", *olderThan, err)
+		}
+	}
+	if *newerThan != "" {
+		if o.newerThan, err = parseAge(*newerThan); err != nil {
+			return nil, nil, fmt.Errorf("invalid --newer-than %q: %v", *newerThan, err)
+		}
+	}
+	if o.dupMinSize, err = parseSize(*dupMinSize); err != nil {
+		return nil, nil, fmt.Errorf("invalid --duplicates-min-size %q: %v", *dupMinSize, err)
+	}
+	if o.stale, err = parseAge(*stale); err != nil {
+		return nil, nil, fmt.Errorf("invalid --stale %q: %v", *stale, err)
+	}
+	if o.blockSize, err = parseSize(*blockSize); err != nil {
+		return nil, nil, fmt.Errorf("invalid --block-size %q: %v", *blockSize, err)
+	}
+	if o.blockSize < 0 {
+		return nil, nil, fmt.Errorf("invalid --block-size %q, must not be negative", *blockSize)
+	}
+	if o.cumulative < 0 || o.cumulative > 100 {
+		return nil, nil, fmt.Errorf("invalid --cumulative-percent %v, must be between 0 and 100", o.cumulative)
+	}
+	if o.precision < 0 {
+		return nil, nil, fmt.Errorf("invalid --precision %d, must not be negative", o.precision)
+	}
+	if *tmpl != "" {
+		s := strings.NewReplacer(`\t`, "\t", `\n`, "\n").Replace(*tmpl)
+		if o.template, err = template.New("format").Parse(s); err != nil {
+			return nil, nil, fmt.Errorf("invalid --format: %v", err)
+		}
+	}
+	o.format = bloat.FormatText
+	switch {
+	case o.template != nil:
+		o.format = bloat.FormatTemplate
+	case *jsonp:
+		o.format = bloat.FormatJSON
+	case *jsonl:
+		o.format = bloat.FormatJSONLines
+	case *csvp:
+		o.format = bloat.FormatCSV
+	case *tree:
+		o.format = bloat.FormatTree
+	case *print0:
+		o.format = bloat.FormatPrint0
+	case *duFormat:
+		o.format = bloat.FormatDU
+	case *prometheus:
+		o.format = bloat.FormatPrometheus
+	case *html:
+		o.format = bloat.FormatHTML
 	}
-	sort.Slice(b.Dirs, func(x, y int) bool { return b.Dirs[x].Bytes > b.Dirs[y].Bytes })
+	o.base = 10
+	o.human = *human
+	switch {
+	case *rawBytes:
+		o.base = 0
+	case *iec:
+		o.base = 2
+	case *si:
+		o.base = 10
+	}
+	return o, fs.Args(), nil
 }
 
-// AddBloat adds the specified number of bytes of bloat to the total for the specified
-// directory, adding new map entries to the DirMap as necessary.
-func (b *Bloat) AddBloat(dir string, bytes int64) {
-	info, ok := b.DirMap[dir]
-	if !ok {
-		info = &DirInfo{Path: dir, Bytes: bytes}
-		b.DirMap[dir] = info
-		return
+// newBloat returns a new empty Bloat configured with the options
+func (o *options) newBloat() *bloat.Bloat {
+	b := bloat.NewBloat(o.abs)
+	b.RelativeTo = o.relativeTo
+	b.PrefixRoots = o.prefixRoots
+	b.RootLabel = o.rootLabel
+	b.NormalizeUnicode = o.normalize
+	b.Top = o.top
+	b.CumulativePercent = o.cumulative
+	b.Depth = o.depth
+	b.LowMemory = o.lowMemory
+	b.MaxEntries = o.maxEntries
+	b.MinDepth = o.minDepth
+	b.MinSize = o.minSize
+	b.MaxSize = o.maxSize
+	b.Summary = o.summary
+	b.NoRoot = o.noRoot
+	b.Empty = o.empty
+	b.GrandTotal = o.grandTotal
+	b.Format = o.format
+	b.Template = o.template
+	b.Base = o.base
+	b.Precision = o.precision
+	b.Human = o.human
+	b.GroupDigits = o.groupDigits
+	if o.meta {
+		b.Meta = &bloat.ReportMeta{Args: os.Args[1:]}
+	}
+	b.Verbose = o.verbose
+	b.RecordSkipped = o.showSkipped
+	b.SampleLimit = o.sampleLimit
+	b.Exclude = o.exclude
+	b.ExcludePaths = o.excludePaths
+	b.ReportMatch = o.reportMatch
+	b.IgnoreCase = o.ignoreCase
+	b.Include = o.include
+	b.NoHidden = o.noHidden
+	b.GitIgnore = o.gitIgnore
+	b.OnlyIgnored = o.onlyIgnored
+	b.Color = o.color == colorAlways
+	b.QuoteNames = o.quoteNames
+	b.RedSize = o.redSize
+	b.YellowSize = o.yellowSize
+	b.ShowCount = o.showCount
+	b.ShowAverage = o.showAvg
+	b.Self = o.self
+	b.ShowPercent = o.showPercent || o.compare
+	b.Compare = o.compare
+	b.ShowMax = o.showMax
+	b.Fields = o.fields
+	b.CountLinks = o.countLinks
+	b.CountDirs = o.countDirs
+	b.OneFileSystem = o.oneFS
+	b.FollowSymlinks = o.followSymlinks
+	b.FollowRoot = o.followRoot
+	b.FollowTopLevel = o.followTop
+	b.InspectArchives = o.archives
+	b.DiskUsage = o.diskUsage
+	b.Compressed = o.compressed
+	b.Fast = o.fast
+	b.BlockSize = o.blockSize
+	b.ByExtension = o.byExtension
+	b.FileSizeCap = o.fileSizeCap
+	now := time.Now()
+	if o.olderThan > 0 {
+		b.ModifiedBefore = now.Add(-o.olderThan)
+	}
+	if o.newerThan > 0 {
+		b.ModifiedAfter = now.Add(-o.newerThan)
+	}
+	if o.breakdown != "" {
+		b.Breakdown = filepath.Clean(o.breakdown)
+		if o.abs {
+			if abs, err := filepath.Abs(o.breakdown); err == nil {
+				b.Breakdown = abs
+			}
+		}
+		b.BreakdownRecursive = o.breakdownAll
+	}
+	if o.cleanup {
+		b.Disposable = o.disposable
+		if len(b.Disposable) == 0 {
+			b.Disposable = bloat.DefaultDisposable
+		}
+		if o.stale > 0 {
+			b.StaleBefore = now.Add(-o.stale)
+		}
+	}
+	if o.largest > 0 {
+		b.Largest = bloat.NewLargestFiles(o.largest)
+	}
+	if o.duplicates {
+		b.Duplicates = bloat.NewDuplicates(o.dupMinSize)
 	}
-	info.Bytes += bytes
+	return b
 }
 
-// AddFile adds the bloat from a single file to the total for the file's directory
-// and all parent directores of that directory
-func (b *Bloat) AddFile(path string, bytes int64) {
-	dir := path
-	ldir := dir
-	for {
-		dir = filepath.Dir(dir)
-		if ldir == dir {
+// validField reports whether field is one of the fields --fields can select
+func validField(field string) bool {
+	for _, f := range bloat.AllFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// flagSet is the set of command line flags, for help to describe
+var flagSet *flag.FlagSet
+
+// wantsHelp reports whether the arguments include a DOS or Windows style request
+// for help, which the flag package doesn't recognize
+func wantsHelp(args []string) bool {
+	for _, arg := range args {
+		if arg == "--" {
 			break
 		}
-		b.AddBloat(dir, bytes)
-		ldir = dir
+		if arg == "/?" || arg == "-?" {
+			return true
+		}
 	}
+	return false
 }
 
-// Scan walks all files under the specified base dir, and totals their sizes into the Bloat
-func (b *Bloat) Scan(basedir string) {
-	werr := filepath.Walk(basedir, func(path string, f os.FileInfo, err error) error {
+func main() {
+	args := os.Args[1:]
+	if wantsHelp(args) {
+		// Parse no arguments, just to set up the flags for help to list.
+		parseFlags(nil)
+		help()
+		return
+	}
+	opts, dirs, err := parseFlags(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", flagSet.Name(), err)
+		os.Exit(2)
+	}
+	if len(dirs) == 0 && opts.filesFrom == "" && opts.load == "" {
+		help()
+		return
+	}
+	out := os.Stdout
+	if opts.output != "" {
+		if out, err = os.Create(opts.output); err != nil {
+			fmt.Fprintf(os.Stderr, "can't create output file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if opts.interactive && !(isTerminal(os.Stdin) && isTerminal(out)) {
+		fmt.Fprintf(os.Stderr, "%s: --interactive needs a terminal\n", flagSet.Name())
+		os.Exit(2)
+	}
+	if opts.diff {
+		err = diffReports(opts.newBloat(), out, dirs[0], dirs[1])
+		if cerr := out.Close(); err == nil && opts.output != "" {
+			err = cerr
+		}
 		if err != nil {
-			return err
+			fmt.Fprintf(os.Stderr, "can't compare reports: %v\n", err)
+			os.Exit(1)
 		}
-		var fdir string
-		var perr error
-		if b.Abs {
-			fdir, perr = filepath.Abs(path)
-		} else {
-			fdir, perr = filepath.Rel(basedir, path)
+		return
+	}
+	if opts.watch > 0 {
+		watch(opts, dirs, out)
+		return
+	}
+	var baseline *bloat.Bloat
+	if opts.sinceScan != "" {
+		baseline = opts.newBloat()
+		if err := loadCache(baseline, opts.sinceScan); err != nil {
+			fmt.Fprintf(os.Stderr, "can't load baseline: %v\n", err)
+			os.Exit(1)
 		}
-		if perr != nil {
-			fmt.Fprintf(os.Stderr, "can't process %s: %v\n", path, perr)
-			panic(err)
+	}
+	// On SIGINT, stop scanning but still report what has been found so far.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	b, failed := scan(ctx, opts, dirs, out)
+	interrupted := ctx.Err() != nil
+	stop()
+	if opts.save != "" && !interrupted {
+		if err := saveCache(b, opts.save); err != nil {
+			fmt.Fprintf(os.Stderr, "can't save cache: %v\n", err)
+			failed = true
 		}
-		b.AddFile(fdir, f.Size())
-		return nil
-	})
-	if werr != nil {
-		fmt.Fprintf(os.Stderr, "error scanning %s: %v\n", basedir, werr)
+	}
+	if interrupted {
+		fmt.Fprintln(os.Stderr, "interrupted, reporting partial results")
+	} else if b.Sampled {
+		fmt.Fprintf(os.Stderr, "(partial, sampled %d files)\n", b.SampleLimit)
+	}
+	b.Sort(opts.sortBy, opts.reverse)
+	switch {
+	case opts.interactive:
+		err = browse(b, out)
+	case baseline != nil:
+		err = reportGrowth(b, baseline, out)
+	case opts.duplicates:
+		err = b.ReportDuplicates(out)
+	case opts.cleanup:
+		err = b.ReportCleanup(out)
+	default:
+		err = b.Report(out)
+	}
+	if err == nil && b.Breakdown != "" {
+		err = writeBreakdown(b, out)
+	}
+	if cerr := out.Close(); err == nil && opts.output != "" {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't write report: %v\n", err)
+		os.Exit(1)
+	}
+	reportSkipped(b.Skipped())
+	if b.Truncated() {
+		fmt.Fprintf(os.Stderr, "more than %d directories found, the rest are totalled as %s\n", b.MaxEntries, bloat.OtherDirs)
+	}
+	if opts.maxFiles >= 0 {
+		reportCrowded(b.Crowded(opts.maxFiles))
+	}
+	if opts.verbose {
+		reportThroughput(b)
+	}
+	reportErrors(b.Errors)
+	if interrupted {
+		os.Exit(130)
+	}
+	if failed || len(b.Errors) > 0 {
+		os.Exit(1)
 	}
 }
 
-// Report outputs the results of the scan
-func (b *Bloat) Report() {
-	for _, info := range b.Dirs {
-		bs := bytesize.FormatBytes(info.Bytes, 10, 0)
-		fmt.Printf("%6s %s\n", bs, info.Path)
+// scan returns a new Bloat configured with the options for writing a report to
+// out, after scanning the --files-from list and the DIRs into it. It also reports
+// whether anything couldn't be scanned, having written the errors to stderr.
+func scan(ctx context.Context, opts *options, dirs []string, out *os.File) (*bloat.Bloat, bool) {
+	b := opts.newBloat()
+	if opts.color == colorAuto {
+		b.Color = isTerminal(out)
+	}
+	if !opts.quoteSet {
+		b.QuoteNames = isTerminal(out)
+	}
+	if !opts.noProgress && !opts.verbose && isTerminal(os.Stderr) {
+		b.Progress = os.Stderr
+	}
+	// failed is set if anything couldn't be scanned, so the exit status can say so.
+	failed := false
+	if opts.load != "" {
+		if err := loadCache(b, opts.load); err != nil {
+			fmt.Fprintf(os.Stderr, "can't load cache: %v\n", err)
+			failed = true
+		}
+	}
+	if opts.filesFrom != "" {
+		if err := scanFileList(b, opts.filesFrom); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+		}
 	}
+	for _, dir := range dirs {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := b.ScanContext(ctx, dir); err != nil && ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", flagSet.Name(), err)
+			failed = true
+		}
+	}
+	return b, failed
 }
 
-func main() {
-	if len(os.Args) < 2 {
-		help()
-		return
+// clearScreen is the ANSI escape sequence to clear the terminal and move the
+// cursor to the top left
+const clearScreen = "\x1b[H\x1b[2J"
+
+// watch scans the DIRs and writes the report to out over and over, clearing the
+// screen first and waiting for the --watch interval between scans, until it's
+// interrupted
+func watch(opts *options, dirs []string, out *os.File) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	interval := time.Duration(opts.watch) * time.Second
+	for {
+		b, _ := scan(ctx, opts, dirs, out)
+		if ctx.Err() != nil {
+			return
+		}
+		b.Sort(opts.sortBy, opts.reverse)
+		fmt.Fprint(out, clearScreen)
+		fmt.Fprintf(out, "Every %v: %s    %s\n\n", interval, strings.Join(dirs, " "), time.Now().Format("2006-01-02 15:04:05"))
+		if err := b.Report(out); err != nil {
+			fmt.Fprintf(os.Stderr, "can't write report: %v\n", err)
+			os.Exit(1)
+		}
+		reportErrors(b.Errors)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
 	}
-	helpp := os.Args[1]
-	if helpp == "--help" || helpp == "-h" || helpp == "/?" {
-		help()
+}
+
+// isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// reportThroughput writes how long the scans took, and how many files and bytes
+// they got through per second, to stderr
+func reportThroughput(b *bloat.Bloat) {
+	elapsed := b.Elapsed()
+	var files, bytes float64
+	if secs := elapsed.Seconds(); secs > 0 {
+		files = float64(b.TotalFiles) / secs
+		bytes = float64(b.TotalBytes) / secs
+	}
+	fmt.Fprintf(os.Stderr, "scanned %d files, %s in %.3fs (%.0f files/s, %s/s)\n", b.TotalFiles,
+		b.FormatSize(b.TotalBytes), elapsed.Seconds(), files, b.FormatSize(int64(bytes)))
+}
+
+// reportSkipped writes the files and directories which were skipped to stderr,
+// with the reasons
+func reportSkipped(skipped []bloat.SkippedPath) {
+	for _, s := range skipped {
+		fmt.Fprintf(os.Stderr, "skipped %s: %s\n", s.Path, s.Reason)
+	}
+}
+
+// reportCrowded writes a warning to stderr for each directory which immediately
+// contains too many files, with the number it contains
+func reportCrowded(dirs []*bloat.DirInfo) {
+	for _, info := range dirs {
+		fmt.Fprintf(os.Stderr, "%s contains %d files\n", info.Path, info.SelfFiles)
+	}
+}
+
+// reportErrors writes the errors for files which were skipped to stderr, followed
+// by a count of them
+func reportErrors(errs []error) {
+	if len(errs) == 0 {
 		return
 	}
-	absmode := len(os.Args) > 2
-	bloat := NewBloat(absmode)
-	for _, arg := range os.Args[1:] {
-		bloat.Scan(arg)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	noun := "files"
+	if len(errs) == 1 {
+		noun = "file"
+	}
+	fmt.Fprintf(os.Stderr, "%d %s skipped due to errors\n", len(errs), noun)
+}
+
+// parseSize parses a human-readable size such as 10M or 1.5GB into a number of
+// bytes. A plain number is a count of bytes, and a single letter suffix K, M, G,
+// T, P or E is taken to mean 1024-based units, as with du. Anything else is parsed
+// by bytesize.ParseBytes, so both KB and KiB style units are accepted.
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+	if n := len(s); n > 1 && strings.ContainsRune("KMGTPE", unicode.ToUpper(rune(s[n-1]))) {
+		if _, err := strconv.ParseFloat(s[:n-1], 64); err == nil {
+			s = s[:n-1] + strings.ToUpper(s[n-1:]) + "iB"
+		}
+	}
+	return bytesize.ParseBytes(s)
+}
+
+// ageUnits are the units accepted by parseAge in addition to those understood by
+// time.ParseDuration. Months and years are approximate.
+var ageUnits = map[string]time.Duration{
+	"d":      24 * time.Hour,
+	"day":    24 * time.Hour,
+	"days":   24 * time.Hour,
+	"w":      7 * 24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+	"weeks":  7 * 24 * time.Hour,
+	"mo":     30 * 24 * time.Hour,
+	"month":  30 * 24 * time.Hour,
+	"months": 30 * 24 * time.Hour,
+	"y":      365 * 24 * time.Hour,
+	"year":   365 * 24 * time.Hour,
+	"years":  365 * 24 * time.Hour,
+}
+
+// parseAge parses an age such as 90d, 6months or 1.5y into a duration. Days,
+// weeks, months (30 days) and years (365 days) are accepted, as well as anything
+// time.ParseDuration understands, such as 12h.
+func parseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, unicode.IsLetter)
+	if i > 0 {
+		if unit, ok := ageUnits[strings.ToLower(s[i:])]; ok {
+			n, err := strconv.ParseFloat(s[:i], 64)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid number %q", s[:i])
+			}
+			return time.Duration(n * float64(unit)), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("unknown age %q, expected a number followed by d, w, mo or y", s)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("age %q must not be negative", s)
+	}
+	return d, nil
+}
+
+// writeBreakdown writes the totals by extension for the --breakdown directory,
+// with a heading if the report is text
+func writeBreakdown(b *bloat.Bloat, out io.Writer) error {
+	if b.Format == bloat.FormatText || b.Format == bloat.FormatTree {
+		if _, err := fmt.Fprintf(out, "\nBreakdown of %s by extension:\n", b.Breakdown); err != nil {
+			return err
+		}
+	}
+	return b.ReportBreakdown(out)
+}
+
+// diffReports writes the changes between the old and new JSON reports in the
+// named files to out
+func diffReports(b *bloat.Bloat, out io.Writer, oldName string, newName string) error {
+	old, oldMeta, err := loadReport(oldName)
+	if err != nil {
+		return err
+	}
+	new, newMeta, err := loadReport(newName)
+	if err != nil {
+		return err
+	}
+	if oldMeta != nil && newMeta != nil && b.Format != bloat.FormatJSON {
+		elapsed := newMeta.Started.Sub(oldMeta.Started).Round(time.Second)
+		if _, err := fmt.Fprintf(out, "Changes in %s between scans started %s and %s:\n", elapsed,
+			oldMeta.Started.Format(time.RFC3339), newMeta.Started.Format(time.RFC3339)); err != nil {
+			return err
+		}
+	}
+	return b.ReportDiff(out, bloat.Diff(old, new))
+}
+
+// reportGrowth writes the changes in size of the directories in b since the
+// baseline scan to out, for the directories the report would include
+func reportGrowth(b *bloat.Bloat, baseline *bloat.Bloat, out io.Writer) error {
+	baseline.Sort(bloat.SortPath, false)
+	if started := baseline.Started(); !started.IsZero() && b.Format != bloat.FormatJSON {
+		if _, err := fmt.Fprintf(out, "Changes since the scan started %s:\n", started.Format(time.RFC3339)); err != nil {
+			return err
+		}
+	}
+	return b.ReportDiff(out, b.SelectDeltas(bloat.Diff(baseline.Dirs, b.Dirs)))
+}
+
+// loadReport reads the JSON report in the named file
+func loadReport(name string) ([]*bloat.DirInfo, *bloat.ReportMeta, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	dirs, meta, err := bloat.LoadJSONMeta(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't read %s: %w", name, err)
+	}
+	return dirs, meta, nil
+}
+
+// saveCache saves the totals in b to the named cache file
+func saveCache(b *bloat.Bloat, name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := b.SaveCache(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadCache loads the totals saved in the named cache file into b
+func loadCache(b *bloat.Bloat, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := b.LoadCache(f); err != nil {
+		return fmt.Errorf("can't read %s: %w", name, err)
+	}
+	return nil
+}
+
+// scanFileList totals the files listed in the named file, or stdin if the name is -
+func scanFileList(b *bloat.Bloat, name string) error {
+	if name == "-" {
+		return b.ScanList(os.Stdin)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return err
 	}
-	bloat.Sort()
-	bloat.Report()
+	defer f.Close()
+	return b.ScanList(f)
 }
 
 func help() {
-	fmt.Printf("Usage: %s [DIR]...\n\n", filepath.Base(os.Args[0]))
+	fmt.Printf("Usage: %s [OPTION]... [DIR]...\n", filepath.Base(os.Args[0]))
+	fmt.Printf("  or:  %s --diff [OPTION]... OLD.json NEW.json\n\n", filepath.Base(os.Args[0]))
 	fmt.Println("Summarize disk space in use under the specified directory or directories.")
 	fmt.Println("Each directory is output along with the total size of all files under that directory.")
 	fmt.Println("The most bloated directories are reported first.")
-	fmt.Println("With a single DIR, output is displayed as relative directory paths.")
-	fmt.Println("With multiple DIRs, all dir paths are made absolute for output, but only data under the")
-	fmt.Println("specified DIRs counts towards the totals displayed.")
-	fmt.Println("If the DIRs overlap or are repeated, you will get inaccurate output because\nfiles will be counted multiple times.")
-	fmt.Println("\nExample invocation:\n\n    bloat ~/Downloads | head -n 10")
+	fmt.Println("Directory paths are displayed relative to the DIR they were found under, unless")
+	fmt.Println("--abs is given, in which case they are made absolute. With multiple DIRs, use --abs")
+	fmt.Println("or --prefix-roots to keep identically named directories under different DIRs apart;")
+	fmt.Println("either way, only data under the specified DIRs counts towards the totals displayed.")
+	fmt.Println("If the DIRs overlap or are repeated, files under more than one of them are only")
+	fmt.Println("counted the first time they are found.")
+	fmt.Println("The exit status is 1 if any file or directory couldn't be read, or 130 if the")
+	fmt.Println("scan was interrupted; the report is output either way.")
+	fmt.Println("\nOptions:")
+	flagSet.SetOutput(os.Stdout)
+	flagSet.PrintDefaults()
+	fmt.Println("\nExample invocation:\n\n    bloat --top 10 ~/Downloads")
 }